@@ -1,19 +1,34 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
 
+	"TapHub/backend"
+	"TapHub/graph"
+	"TapHub/monitor"
+	localrfq "TapHub/rfq"
+	"TapHub/store"
+	"TapHub/webhook"
+
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/lightninglabs/taproot-assets/rfq"
 
 	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
 
 	"github.com/lightninglabs/taproot-assets/taprpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/assetwalletrpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/tapchannelrpc"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
 )
 
 type proxy struct {
@@ -21,12 +36,59 @@ type proxy struct {
 }
 type Handler struct {
 	// litRpcURI on-demand for account-level client connections.
-	litRpcURI       string
-	lightningClient lnrpc.LightningClient
-	tapClient       taprpc.TaprootAssetsClient
-	universeClient  universerpc.UniverseClient
-	oracleProxy     *proxy
-	oracle          *rfq.RpcPriceOracle
+	litRpcURI         string
+	lightningClient   lnrpc.LightningClient
+	chainClient       chainrpc.ChainNotifierClient
+	invoicesClient    invoicesrpc.InvoicesClient
+	tapClient         taprpc.TaprootAssetsClient
+	assetWalletClient assetwalletrpc.AssetWalletClient
+	tapChannelClient  tapchannelrpc.TaprootAssetChannelsClient
+	universeClient    universerpc.UniverseClient
+	oracleProxy       *proxy
+	oracle            *rfq.RpcPriceOracle
+	nodeOracles       *priceOracles
+	auth              *authStore
+	store             *store.Store
+	graph             *graph.Index
+	monitor           *monitor.Monitor
+	webhooks          *webhook.Dispatcher
+	priceOracle       localrfq.Oracle
+	events            *eventHub
+
+	// backends are every lnd/tapd TapHub runs on. The clients above are
+	// the default backend's, which everything that keeps state uses.
+	backends *backend.Pool
+
+	// readiness caches the last readiness check.
+	readiness *readinessCache
+
+	holdingsChallenges *holdingsChallenges
+	holdings           *holdingsWatcher
+	invoices           *invoiceWatcher
+	universeSyncer     *universeSyncer
+
+	// admins are the node pubkeys allowed to use the admin routes.
+	admins map[string]bool
+
+	// spec is the OpenAPI document requests are validated against.
+	spec     *openapi3.T
+	specJSON []byte
+
+	router *router
+
+	limits              Limits
+	ipLimiter           *keyedLimiter
+	verifyIPLimiter     *keyedLimiter
+	verifyPubkeyLimiter *keyedLimiter
+	// tapdSlots holds a token per request calling tapd.
+	tapdSlots chan struct{}
+	// invoiceStreams caps the open /streamInvoice streams.
+	invoiceStreams *streamSlots
+
+	// identities are the pubkeys of the backends' lnds by backend name,
+	// looked up on first use.
+	identityMu sync.Mutex
+	identities map[string]string
 }
 
 func newProxy(target string, prefix string) (*proxy, error) {
@@ -54,7 +116,7 @@ func newProxy(target string, prefix string) (*proxy, error) {
 	return &proxy{p}, nil
 }
 
-func New(lightningClient lnrpc.LightningClient, tapClient taprpc.TaprootAssetsClient, universeClient universerpc.UniverseClient, oracleWeb, oracle string, enableRfq bool) (*Handler, error) {
+func New(backends *backend.Pool, db *store.Store, g *graph.Index, mon *monitor.Monitor, webhooks *webhook.Dispatcher, priceOracle localrfq.Oracle, oracleWeb, oracle string, enableRfq bool, adminPubkeys []string, limits Limits) (*Handler, error) {
 	fmt.Printf("inside api new\n")
 	var o *proxy
 	var orc *rfq.RpcPriceOracle
@@ -71,28 +133,166 @@ func New(lightningClient lnrpc.LightningClient, tapClient taprpc.TaprootAssetsCl
 		}
 	}
 
-	return &Handler{
+	spec, specJSON, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	admins := make(map[string]bool, len(adminPubkeys))
+	for _, pubkey := range adminPubkeys {
+		admins[pubkey] = true
+	}
+
+	def := backends.Default()
+	h := &Handler{
 		oracleProxy: o,
 		oracle:      orc,
+		nodeOracles: newPriceOracles(),
+		auth:        newAuthStore(),
+		store:       db,
+		graph:       g,
+		monitor:     mon,
+		webhooks:    webhooks,
+		priceOracle: priceOracle,
+		events:      newEventHub(),
 
-		lightningClient: lightningClient,
-		tapClient:       tapClient,
-		universeClient:  universeClient,
-	}, nil
-}
+		backends:           backends,
+		readiness:          newReadinessCache(),
+		holdingsChallenges: newHoldingsChallenges(),
+		holdings:           newHoldingsWatcher(def.Chain, db),
+		universeSyncer:     newUniverseSyncer(def.Universe, db),
+		admins:             admins,
+		spec:               spec,
+		specJSON:           specJSON,
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/detectChannels", h.DetectChannels)
-	mux.HandleFunc("/verifyMessage", h.VerifyMessage)
-	mux.HandleFunc("/verifyProof", h.VerifyProof)
+		limits:              limits,
+		ipLimiter:           newKeyedLimiter(limits.IP),
+		verifyIPLimiter:     newKeyedLimiter(limits.VerifyIP),
+		verifyPubkeyLimiter: newKeyedLimiter(limits.VerifyPubkey),
+		invoiceStreams:      newStreamSlots(limits.InvoiceStreams, limits.InvoiceStreamsPerNode),
+		identities:          make(map[string]string),
 
-	mux.ServeHTTP(w, r)
+		lightningClient:   def.Lightning,
+		chainClient:       def.Chain,
+		invoicesClient:    def.Invoices,
+		tapClient:         def.Taproot,
+		assetWalletClient: def.AssetWallet,
+		tapChannelClient:  def.TapChannels,
+		universeClient:    def.Universe,
+	}
+	h.invoices = newInvoiceWatcher(def.Invoices, db, h.purchaseInvoiceUpdated)
+	if limits.TapdConcurrency > 0 {
+		h.tapdSlots = make(chan struct{}, limits.TapdConcurrency)
+	}
+	h.router, err = h.routes()
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
 }
 
-func (h *Handler) Auth(next http.HandlerFunc) http.HandlerFunc {
+// Start runs the handler's background work until ctx is cancelled.
+func (h *Handler) Start(ctx context.Context) {
+	go h.watchChannels(ctx)
+	go h.invoices.run(ctx)
+	go h.reconcilePurchases(ctx)
+	go h.watchPrices(ctx)
+	go h.holdings.run(ctx)
+	go h.universeSyncer.run(ctx)
+	go h.sampleUptime(ctx)
+	go h.expireChannelRequests(ctx)
+}
 
-	return func(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router.ServeHTTP(w, r)
+}
 
+// routes builds the router. Every route is rate limited by client IP and has
+// its body size capped. Every route but the spec itself has to be described
+// by the spec, which its requests are validated against before the route's
+// own middleware runs, so malformed requests are turned away before they
+// wait for a tapd slot or are sent to another backend.
+func (h *Handler) routes() (*router, error) {
+	rt := newRouter(APIPrefix)
+	var errs []error
+	handle := func(method, path string, next http.HandlerFunc, mws ...middleware) {
+		validate, err := h.validated(method, path)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		bodyLimit := h.limits.MaxBodyBytes
+		if takesProof[path] {
+			bodyLimit = h.limits.MaxProofBodyBytes
+		}
+		chain := append([]middleware{h.limitIP, maxBody(bodyLimit), validate}, mws...)
+		rt.handle(method, path, next, chain...)
 	}
+
+	get, post := http.MethodGet, http.MethodPost
+	rt.handle(get, SpecPath, h.Spec, h.limitIP)
+
+	handle(get, "/livez", h.Live)
+	handle(get, "/readyz", h.Ready)
+
+	handle(post, "/generateChallenge", h.GenerateChallenge, h.limitVerifyIP)
+	handle(post, "/verifyMessage", h.VerifyMessage, h.limitVerifyIP)
+	handle(post, "/detectChannels", h.DetectChannels)
+	handle(post, "/verifyProof", h.VerifyProof, h.limitVerifyIP, h.Auth, h.limitVerifyPubkey, h.tapdSlot)
+
+	handle(post, "/registerNode", h.RegisterNode, h.Auth)
+	handle(get, "/getNode", h.GetNode)
+	handle(get, "/getNodeProfile", h.GetNodeProfile, h.pickBackend)
+	handle(get, "/getNodeReputation", h.GetNodeReputation)
+	handle(get, "/listNodes", h.ListNodes)
+	handle(post, "/deregisterNode", h.DeregisterNode, h.Auth)
+
+	handle(post, "/createListing", h.CreateListing, h.Auth, h.tapdSlot)
+	handle(post, "/updateListing", h.UpdateListing, h.Auth)
+	handle(post, "/deleteListing", h.DeleteListing, h.Auth)
+	handle(get, "/listListings", h.ListListings)
+	handle(get, "/comparePrices", h.ComparePrices, h.limitVerifyIP)
+
+	handle(post, "/createInvoice", h.CreateInvoice, h.Auth, h.tapdSlot)
+	handle(get, "/getInvoice", h.GetInvoice, h.Auth)
+	handle(get, "/streamInvoice", h.StreamInvoice, h.Auth)
+	handle(get, "/listPurchases", h.ListPurchases, h.Auth)
+	handle(get, "/exportPurchases", h.ExportPurchases, h.Auth)
+
+	// tapdSlot comes after pickBackend so a fanned out request takes a
+	// slot for every backend it calls.
+	handle(get, "/listAssets", h.ListAssets, h.pickBackend, h.tapdSlot)
+	handle(get, "/getAsset", h.GetAsset, h.pickBackend, h.tapdSlot)
+	handle(get, "/listAssetRoots", h.ListAssetRoots, h.pickBackend, h.tapdSlot)
+	handle(get, "/listAssetLeaves", h.ListAssetLeaves, h.pickBackend, h.tapdSlot)
+	handle(get, "/universeStats", h.UniverseStats, h.pickBackend, h.tapdSlot)
+
+	handle(get, "/listBackends", h.ListBackends)
+
+	// Federation servers and syncs are recorded in the store without
+	// a backend, so these only run on the default backend.
+	handle(get, "/listFederationServers", h.ListFederationServers, h.Admin, h.tapdSlot)
+	handle(post, "/addFederationServer", h.AddFederationServer, h.Admin, h.tapdSlot)
+	handle(post, "/deleteFederationServer", h.DeleteFederationServer, h.Admin, h.tapdSlot)
+	handle(post, "/syncUniverse", h.SyncUniverse, h.Admin)
+	handle(get, "/listUniverseSyncs", h.ListUniverseSyncs, h.Admin)
+
+	handle(post, "/createHoldingsChallenge", h.CreateHoldingsChallenge, h.limitVerifyIP, h.Auth, h.limitVerifyPubkey)
+	handle(post, "/verifyHoldings", h.VerifyHoldings, h.limitVerifyIP, h.Auth, h.limitVerifyPubkey)
+
+	handle(post, "/createChannelRequest", h.CreateChannelRequest, h.Auth)
+	handle(get, "/getChannelRequest", h.GetChannelRequest, h.Auth)
+	handle(get, "/listChannelRequests", h.ListChannelRequests, h.Auth)
+	handle(post, "/advanceChannelRequest", h.AdvanceChannelRequest, h.Auth)
+	handle(get, "/listChannels", h.ListChannels)
+
+	handle(post, "/createWebhook", h.CreateWebhook, h.Auth)
+	handle(get, "/listWebhooks", h.ListWebhooks, h.Auth)
+	handle(post, "/deleteWebhook", h.DeleteWebhook, h.Auth)
+	handle(get, "/listWebhookDeliveries", h.ListWebhookDeliveries, h.Auth)
+
+	handle(get, StreamPath, h.Events, h.Auth)
+
+	return rt, errors.Join(errs...)
 }
@@ -0,0 +1,630 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"TapHub/backend"
+	"TapHub/store"
+
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+
+	// maxAssetSearchScan caps how many universe assets a name search
+	// looks through. The universe can only filter on exact names, so
+	// substring searches are done on our side.
+	maxAssetSearchScan = 10000
+)
+
+// universeAsset is an asset as our universe knows it.
+type universeAsset struct {
+	AssetID          string    `json:"assetId"`
+	Name             string    `json:"name"`
+	Type             string    `json:"type"`
+	GenesisPoint     string    `json:"genesisPoint"`
+	GenesisHeight    int32     `json:"genesisHeight"`
+	GenesisTimestamp time.Time `json:"genesisTimestamp"`
+	AnchorPoint      string    `json:"anchorPoint"`
+	DecimalDisplay   uint32    `json:"decimalDisplay"`
+	TotalSupply      int64     `json:"totalSupply"`
+}
+
+func newUniverseAsset(a *universerpc.AssetStatsAsset) *universeAsset {
+	if a == nil {
+		return nil
+	}
+
+	return &universeAsset{
+		AssetID:          hex.EncodeToString(a.AssetId),
+		Name:             a.AssetName,
+		Type:             assetTypeName(a.AssetType),
+		GenesisPoint:     a.GenesisPoint,
+		GenesisHeight:    a.GenesisHeight,
+		GenesisTimestamp: time.Unix(a.GenesisTimestamp, 0),
+		AnchorPoint:      a.AnchorPoint,
+		DecimalDisplay:   a.DecimalDisplay,
+		TotalSupply:      a.TotalSupply,
+	}
+}
+
+// assetStats is the universe's sync statistics for an asset, or for an asset
+// group, in which case Asset is nil and GroupAnchor is set.
+type assetStats struct {
+	Asset       *universeAsset `json:"asset,omitempty"`
+	GroupKey    string         `json:"groupKey,omitempty"`
+	GroupSupply int64          `json:"groupSupply,omitempty"`
+	GroupAnchor *universeAsset `json:"groupAnchor,omitempty"`
+	TotalSyncs  int64          `json:"totalSyncs"`
+	TotalProofs int64          `json:"totalProofs"`
+
+	// LastSync is our last federation sync that changed the asset's
+	// universe, or its group's. It's only known for the default backend,
+	// which is the one we sync.
+	LastSync *store.AssetSync `json:"lastSync,omitempty"`
+}
+
+func newAssetStats(s *universerpc.AssetStatsSnapshot) assetStats {
+	stats := assetStats{
+		Asset:       newUniverseAsset(s.Asset),
+		GroupSupply: s.GroupSupply,
+		GroupAnchor: newUniverseAsset(s.GroupAnchor),
+		TotalSyncs:  s.TotalSyncs,
+		TotalProofs: s.TotalProofs,
+	}
+	if len(s.GroupKey) > 0 {
+		stats.GroupKey = hex.EncodeToString(s.GroupKey)
+	}
+
+	return stats
+}
+
+// universe returns the key our syncs record the asset's universe under.
+func (s assetStats) universe() string {
+	if s.GroupKey != "" {
+		key, _ := hex.DecodeString(s.GroupKey)
+		return universeKey(&universerpc.ID{Id: &universerpc.ID_GroupKey{GroupKey: key}})
+	}
+	if s.Asset != nil {
+		return s.Asset.AssetID
+	}
+	return ""
+}
+
+// universeKey returns the hex asset id or x-only group key of a universe.
+func universeKey(id *universerpc.ID) string {
+	if key := id.GetGroupKey(); len(key) > 0 {
+		if len(key) == 33 {
+			key = key[1:]
+		}
+		return hex.EncodeToString(key)
+	}
+	if assetID := id.GetAssetId(); len(assetID) > 0 {
+		return hex.EncodeToString(assetID)
+	}
+	return ""
+}
+
+// addLastSyncs fills in the last sync of each of assets from the store. b
+// is the backend the stats came from.
+func (h *Handler) addLastSyncs(ctx context.Context, b *backend.Backend, assets []assetStats) error {
+	if b != h.backends.Default() {
+		return nil
+	}
+
+	universes := make([]string, 0, len(assets))
+	for _, a := range assets {
+		if key := a.universe(); key != "" {
+			universes = append(universes, key)
+		}
+	}
+	syncs, err := h.store.LastAssetSyncs(ctx, universes)
+	if err != nil {
+		return err
+	}
+	for i := range assets {
+		if last, ok := syncs[assets[i].universe()]; ok {
+			assets[i].LastSync = &last
+		}
+	}
+
+	return nil
+}
+
+// name returns the name of the asset, or of the group's anchor asset.
+func (s assetStats) name() string {
+	if s.Asset != nil {
+		return s.Asset.Name
+	}
+	if s.GroupAnchor != nil {
+		return s.GroupAnchor.Name
+	}
+	return ""
+}
+
+// universeRoot is the root of one of an asset's universe trees. RootSum is
+// the total amount the tree commits to.
+type universeRoot struct {
+	RootHash string `json:"rootHash"`
+	RootSum  int64  `json:"rootSum"`
+}
+
+func newUniverseRoot(r *universerpc.UniverseRoot) *universeRoot {
+	if r == nil || r.MssmtRoot == nil {
+		return nil
+	}
+
+	return &universeRoot{
+		RootHash: hex.EncodeToString(r.MssmtRoot.RootHash),
+		RootSum:  r.MssmtRoot.RootSum,
+	}
+}
+
+func assetTypeName(t taprpc.AssetType) string {
+	if t == taprpc.AssetType_COLLECTIBLE {
+		return "collectible"
+	}
+	return "normal"
+}
+
+var assetTypeFilters = map[string]universerpc.AssetTypeFilter{
+	"":            universerpc.AssetTypeFilter_FILTER_ASSET_NONE,
+	"normal":      universerpc.AssetTypeFilter_FILTER_ASSET_NORMAL,
+	"collectible": universerpc.AssetTypeFilter_FILTER_ASSET_COLLECTIBLE,
+}
+
+var assetSorts = map[string]universerpc.AssetQuerySort{
+	"":              universerpc.AssetQuerySort_SORT_BY_NONE,
+	"name":          universerpc.AssetQuerySort_SORT_BY_ASSET_NAME,
+	"assetId":       universerpc.AssetQuerySort_SORT_BY_ASSET_ID,
+	"type":          universerpc.AssetQuerySort_SORT_BY_ASSET_TYPE,
+	"syncs":         universerpc.AssetQuerySort_SORT_BY_TOTAL_SYNCS,
+	"proofs":        universerpc.AssetQuerySort_SORT_BY_TOTAL_PROOFS,
+	"genesisHeight": universerpc.AssetQuerySort_SORT_BY_GENESIS_HEIGHT,
+	"supply":        universerpc.AssetQuerySort_SORT_BY_TOTAL_SUPPLY,
+}
+
+var sortDirections = map[string]universerpc.SortDirection{
+	"":     universerpc.SortDirection_SORT_DIRECTION_ASC,
+	"asc":  universerpc.SortDirection_SORT_DIRECTION_ASC,
+	"desc": universerpc.SortDirection_SORT_DIRECTION_DESC,
+}
+
+var proofTypes = map[string]universerpc.ProofType{
+	"":         universerpc.ProofType_PROOF_TYPE_ISSUANCE,
+	"issuance": universerpc.ProofType_PROOF_TYPE_ISSUANCE,
+	"transfer": universerpc.ProofType_PROOF_TYPE_TRANSFER,
+}
+
+// page is the offset and limit of a paginated listing.
+type page struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// parsePage reads the offset and limit query parameters.
+func parsePage(q url.Values) (page, bool) {
+	p := page{Limit: defaultPageLimit}
+	if offset := q.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return p, false
+		}
+		p.Offset = n
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			return p, false
+		}
+		p.Limit = n
+	}
+
+	return p, true
+}
+
+// slice returns the part of a list of n items the page covers.
+func (p page) slice(n int) (int, int) {
+	start := min(p.Offset, n)
+	return start, min(start+p.Limit, n)
+}
+
+// universeID turns the assetId or groupKey query parameter into a universe
+// ID.
+func universeID(q url.Values, proofType universerpc.ProofType) (*universerpc.ID, bool) {
+	assetID, groupKey := q.Get("assetId"), q.Get("groupKey")
+	switch {
+	case assetID != "" && groupKey == "":
+		id, err := hex.DecodeString(assetID)
+		if err != nil || len(id) != 32 {
+			return nil, false
+		}
+		return &universerpc.ID{
+			Id:        &universerpc.ID_AssetId{AssetId: id},
+			ProofType: proofType,
+		}, true
+
+	case groupKey != "" && assetID == "":
+		key, err := hex.DecodeString(groupKey)
+		if err != nil || (len(key) != 32 && len(key) != 33) {
+			return nil, false
+		}
+		return &universerpc.ID{
+			Id:        &universerpc.ID_GroupKey{GroupKey: key},
+			ProofType: proofType,
+		}, true
+	}
+
+	return nil, false
+}
+
+// ListAssets lists the assets our universe knows about. name matches names
+// exactly, search matches any part of the name, case insensitively.
+func (h *Handler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := parsePage(q)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid offset or limit, limit must be between 1 and %d", maxPageLimit)
+		return
+	}
+	typeFilter, ok := assetTypeFilters[q.Get("type")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid type %q, expected normal or collectible", q.Get("type"))
+		return
+	}
+	sortBy, ok := assetSorts[q.Get("sortBy")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid sortBy %q", q.Get("sortBy"))
+		return
+	}
+	direction, ok := sortDirections[q.Get("direction")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid direction %q, expected asc or desc", q.Get("direction"))
+		return
+	}
+
+	query := &universerpc.AssetStatsQuery{
+		AssetNameFilter: q.Get("name"),
+		AssetTypeFilter: typeFilter,
+		SortBy:          sortBy,
+		Direction:       direction,
+		Offset:          int32(p.Offset),
+		Limit:           int32(p.Limit),
+	}
+
+	ctx := r.Context()
+	assets := []assetStats{}
+	search := strings.ToLower(q.Get("search"))
+	if search == "" {
+		resp, err := h.backend(r).Universe.QueryAssetStats(ctx, query)
+		if err != nil {
+			writeUpstreamError(w, err, http.StatusBadGateway, "error querying universe asset stats: %s", err.Error())
+			return
+		}
+		for _, snapshot := range resp.AssetStats {
+			assets = append(assets, newAssetStats(snapshot))
+		}
+	} else {
+		// Walk the universe page by page, keeping the matches that fall
+		// into the requested page.
+		query.Offset, query.Limit = 0, maxPageLimit
+		matched := 0
+		for scanned := 0; scanned < maxAssetSearchScan && len(assets) < p.Limit; {
+			resp, err := h.backend(r).Universe.QueryAssetStats(ctx, query)
+			if err != nil {
+				writeUpstreamError(w, err, http.StatusBadGateway, "error querying universe asset stats: %s", err.Error())
+				return
+			}
+			for _, snapshot := range resp.AssetStats {
+				stats := newAssetStats(snapshot)
+				if !strings.Contains(strings.ToLower(stats.name()), search) {
+					continue
+				}
+				if matched >= p.Offset && len(assets) < p.Limit {
+					assets = append(assets, stats)
+				}
+				matched++
+			}
+			if len(resp.AssetStats) < int(query.Limit) {
+				break
+			}
+			scanned += len(resp.AssetStats)
+			query.Offset += query.Limit
+		}
+	}
+	if err := h.addLastSyncs(ctx, h.backend(r), assets); err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Assets []assetStats `json:"assets"`
+		Page   page         `json:"page"`
+	}{
+		Assets: assets,
+		Page:   p,
+	})
+}
+
+// GetAsset returns the universe's statistics, supply and tree roots for a
+// single asset. For grouped assets the roots are those of the whole group.
+func (h *Handler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	assetID := r.URL.Query().Get("assetId")
+	id, err := hex.DecodeString(assetID)
+	if err != nil || len(id) != 32 {
+		writeError(w, http.StatusBadRequest, "invalid asset id %q", assetID)
+		return
+	}
+
+	ctx := r.Context()
+	resp, err := h.backend(r).Universe.QueryAssetStats(ctx, &universerpc.AssetStatsQuery{
+		AssetIdFilter: id,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error querying universe asset stats: %s", err.Error())
+		return
+	}
+	if len(resp.AssetStats) == 0 {
+		writeError(w, http.StatusNotFound, "asset %s not found", assetID)
+		return
+	}
+	snapshot := resp.AssetStats[0]
+
+	rootID := &universerpc.ID{Id: &universerpc.ID_AssetId{AssetId: id}}
+	if len(snapshot.GroupKey) > 0 {
+		rootID = &universerpc.ID{Id: &universerpc.ID_GroupKey{GroupKey: snapshot.GroupKey}}
+	}
+	roots, err := h.backend(r).Universe.QueryAssetRoots(ctx, &universerpc.AssetRootQuery{Id: rootID})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error querying universe roots: %s", err.Error())
+		return
+	}
+
+	stats := newAssetStats(snapshot)
+	statsList := []assetStats{stats}
+	if err := h.addLastSyncs(ctx, h.backend(r), statsList); err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	stats = statsList[0]
+	var supply int64
+	switch {
+	case stats.Asset != nil:
+		supply = stats.Asset.TotalSupply
+	case stats.GroupAnchor != nil:
+		supply = stats.GroupAnchor.TotalSupply
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Stats        assetStats    `json:"stats"`
+		TotalSupply  int64         `json:"totalSupply"`
+		GroupSupply  int64         `json:"groupSupply,omitempty"`
+		IssuanceRoot *universeRoot `json:"issuanceRoot"`
+		TransferRoot *universeRoot `json:"transferRoot"`
+	}{
+		Stats:        stats,
+		TotalSupply:  supply,
+		GroupSupply:  snapshot.GroupSupply,
+		IssuanceRoot: newUniverseRoot(roots.IssuanceRoot),
+		TransferRoot: newUniverseRoot(roots.TransferRoot),
+	})
+}
+
+// ListAssetRoots lists the universe trees our universe holds, one per asset
+// or asset group and proof type.
+func (h *Handler) ListAssetRoots(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := parsePage(q)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid offset or limit, limit must be between 1 and %d", maxPageLimit)
+		return
+	}
+	direction, ok := sortDirections[q.Get("direction")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid direction %q, expected asc or desc", q.Get("direction"))
+		return
+	}
+
+	resp, err := h.backend(r).Universe.AssetRoots(r.Context(), &universerpc.AssetRootRequest{
+		WithAmountsById: true,
+		Offset:          int32(p.Offset),
+		Limit:           int32(p.Limit),
+		Direction:       direction,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error listing universe roots: %s", err.Error())
+		return
+	}
+
+	type assetRoot struct {
+		ID               string            `json:"id"`
+		AssetName        string            `json:"assetName"`
+		AssetID          string            `json:"assetId,omitempty"`
+		GroupKey         string            `json:"groupKey,omitempty"`
+		ProofType        string            `json:"proofType"`
+		Root             *universeRoot     `json:"root"`
+		AmountsByAssetID map[string]uint64 `json:"amountsByAssetId,omitempty"`
+	}
+	roots := make([]assetRoot, 0, len(resp.UniverseRoots))
+	for key, root := range resp.UniverseRoots {
+		ar := assetRoot{
+			ID:               key,
+			AssetName:        root.AssetName,
+			ProofType:        strings.ToLower(strings.TrimPrefix(root.Id.GetProofType().String(), "PROOF_TYPE_")),
+			Root:             newUniverseRoot(root),
+			AmountsByAssetID: root.AmountsByAssetId,
+		}
+		if id := root.Id.GetAssetId(); len(id) > 0 {
+			ar.AssetID = hex.EncodeToString(id)
+		}
+		if key := root.Id.GetGroupKey(); len(key) > 0 {
+			ar.GroupKey = hex.EncodeToString(key)
+		}
+		roots = append(roots, ar)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].ID < roots[j].ID
+	})
+
+	writeJSON(w, http.StatusOK, struct {
+		Roots []assetRoot `json:"roots"`
+		Page  page        `json:"page"`
+	}{
+		Roots: roots,
+		Page:  p,
+	})
+}
+
+// ListAssetLeaves lists the leaves of an asset's or asset group's universe
+// tree, the issuance tree unless proofType=transfer.
+func (h *Handler) ListAssetLeaves(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := parsePage(q)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid offset or limit, limit must be between 1 and %d", maxPageLimit)
+		return
+	}
+	proofType, ok := proofTypes[q.Get("proofType")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid proofType %q, expected issuance or transfer", q.Get("proofType"))
+		return
+	}
+	id, ok := universeID(q, proofType)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "exactly one valid assetId or groupKey is required")
+		return
+	}
+
+	// The universe returns every leaf at once, so the page is cut out
+	// here.
+	resp, err := h.backend(r).Universe.AssetLeaves(r.Context(), id)
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error listing universe leaves: %s", err.Error())
+		return
+	}
+
+	type assetLeaf struct {
+		AssetID        string `json:"assetId"`
+		Name           string `json:"name"`
+		Amount         uint64 `json:"amount"`
+		ScriptKey      string `json:"scriptKey"`
+		AnchorOutpoint string `json:"anchorOutpoint,omitempty"`
+		BlockHeight    uint32 `json:"blockHeight,omitempty"`
+		ProofSize      int    `json:"proofSize"`
+	}
+	start, end := p.slice(len(resp.Leaves))
+	leaves := make([]assetLeaf, 0, end-start)
+	for _, leaf := range resp.Leaves[start:end] {
+		a := leaf.Asset
+		l := assetLeaf{
+			Amount:    a.GetAmount(),
+			ScriptKey: hex.EncodeToString(a.GetScriptKey()),
+			ProofSize: len(leaf.Proof),
+		}
+		if g := a.GetAssetGenesis(); g != nil {
+			l.AssetID = hex.EncodeToString(g.AssetId)
+			l.Name = g.Name
+		}
+		if anchor := a.GetChainAnchor(); anchor != nil {
+			l.AnchorOutpoint = anchor.AnchorOutpoint
+			l.BlockHeight = anchor.BlockHeight
+		}
+		leaves = append(leaves, l)
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Leaves []assetLeaf `json:"leaves"`
+		Total  int         `json:"total"`
+		Page   page        `json:"page"`
+	}{
+		Leaves: leaves,
+		Total:  len(resp.Leaves),
+		Page:   p,
+	})
+}
+
+// UniverseStats returns the universe's totals and its sync and proof
+// activity per day between start and end, unix timestamps that default to
+// the last 30 days.
+func (h *Handler) UniverseStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var start, end int64
+	for name, v := range map[string]*int64{"start": &start, "end": &end} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "invalid %s %q", name, s)
+				return
+			}
+			*v = n
+		}
+	}
+
+	ctx := r.Context()
+	stats, err := h.backend(r).Universe.UniverseStats(ctx, &universerpc.StatsRequest{})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error getting universe stats: %s", err.Error())
+		return
+	}
+	events, err := h.backend(r).Universe.QueryEvents(ctx, &universerpc.QueryEventsRequest{
+		StartTimestamp: start,
+		EndTimestamp:   end,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadRequest, "error querying universe events: %s", err.Error())
+		return
+	}
+
+	// Only the default backend's universe is synced by us.
+	var lastSync *store.UniverseSync
+	if h.backend(r) == h.backends.Default() {
+		syncs, err := h.store.ListUniverseSyncs(ctx, "", 1)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err.Error())
+			return
+		}
+		if len(syncs) > 0 {
+			lastSync = &syncs[0]
+		}
+	}
+
+	type dayEvents struct {
+		Date           string `json:"date"`
+		SyncEvents     uint64 `json:"syncEvents"`
+		NewProofEvents uint64 `json:"newProofEvents"`
+	}
+	days := make([]dayEvents, 0, len(events.Events))
+	for _, e := range events.Events {
+		days = append(days, dayEvents{
+			Date:           e.Date,
+			SyncEvents:     e.SyncEvents,
+			NewProofEvents: e.NewProofEvents,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		NumAssets int64               `json:"numAssets"`
+		NumGroups int64               `json:"numGroups"`
+		NumSyncs  int64               `json:"numSyncs"`
+		NumProofs int64               `json:"numProofs"`
+		LastSync  *store.UniverseSync `json:"lastSync,omitempty"`
+		Events    []dayEvents         `json:"events"`
+	}{
+		NumAssets: stats.NumTotalAssets,
+		NumGroups: stats.NumTotalGroups,
+		NumSyncs:  stats.NumTotalSyncs,
+		NumProofs: stats.NumTotalProofs,
+		LastSync:  lastSync,
+		Events:    days,
+	})
+}
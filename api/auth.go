@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// challengePrefix is prepended to every nonce so a signed challenge
+	// can't be mistaken for any other message the node might sign.
+	challengePrefix = "TapHub Authentication: "
+
+	// challengeTTL is how long an issued challenge may be signed and
+	// submitted to /verifyMessage.
+	challengeTTL = 5 * time.Minute
+
+	// sessionTTL is how long a session token returned by /verifyMessage
+	// stays valid.
+	sessionTTL = 24 * time.Hour
+)
+
+type session struct {
+	pubkey    string
+	expiresAt time.Time
+}
+
+// authStore keeps the outstanding login challenges and the sessions issued
+// for them. Challenges are removed as soon as they are used so a signature
+// can only ever be redeemed once.
+type authStore struct {
+	mu         sync.Mutex
+	challenges map[string]time.Time
+	sessions   map[string]session
+}
+
+func newAuthStore() *authStore {
+	return &authStore{
+		challenges: make(map[string]time.Time),
+		sessions:   make(map[string]session),
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newChallenge issues a fresh challenge message that must be signed by the
+// node logging in.
+func (a *authStore) newChallenge() (string, time.Time, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	challenge := challengePrefix + nonce
+	expiresAt := time.Now().Add(challengeTTL)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneLocked(time.Now())
+	a.challenges[challenge] = expiresAt
+
+	return challenge, expiresAt, nil
+}
+
+// consumeChallenge reports whether the message is a challenge we issued that
+// has not expired. The challenge is removed either way, so it can't be
+// replayed.
+func (a *authStore) consumeChallenge(challenge string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	expiresAt, ok := a.challenges[challenge]
+	if !ok {
+		return false
+	}
+	delete(a.challenges, challenge)
+
+	return time.Now().Before(expiresAt)
+}
+
+// newSession issues a session token for a pubkey that has signed a
+// challenge.
+func (a *authStore) newSession(pubkey string) (string, time.Time, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(sessionTTL)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions[token] = session{
+		pubkey:    pubkey,
+		expiresAt: expiresAt,
+	}
+
+	return token, expiresAt, nil
+}
+
+// lookupSession returns the pubkey the token was issued to.
+func (a *authStore) lookupSession(token string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.sessions[token]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(s.expiresAt) {
+		delete(a.sessions, token)
+		return "", false
+	}
+
+	return s.pubkey, true
+}
+
+func (a *authStore) pruneLocked(now time.Time) {
+	for challenge, expiresAt := range a.challenges {
+		if now.After(expiresAt) {
+			delete(a.challenges, challenge)
+		}
+	}
+	for token, s := range a.sessions {
+		if now.After(s.expiresAt) {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+type pubkeyCtxKey struct{}
+
+// authedPubkey returns the node pubkey of the session behind the request.
+// It is only set on routes wrapped with Handler.Auth.
+func authedPubkey(r *http.Request) string {
+	pubkey, _ := r.Context().Value(pubkeyCtxKey{}).(string)
+	return pubkey
+}
+
+func (h *Handler) GenerateChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, expiresAt, err := h.auth.newChallenge()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "error generating challenge: %s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Challenge string    `json:"challenge"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}{
+		Challenge: challenge,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Auth rejects requests that don't carry a valid session token in the
+// Authorization header and makes the session's pubkey available to next.
+func (h *Handler) Auth(next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeError(w, http.StatusUnauthorized, "missing session token")
+			return
+		}
+
+		pubkey, ok := h.auth.lookupSession(token)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid or expired session token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), pubkeyCtxKey{}, pubkey)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Admin is like Auth, but only lets through sessions of the node pubkeys
+// TapHub was started with as admins.
+func (h *Handler) Admin(next http.HandlerFunc) http.HandlerFunc {
+
+	return h.Auth(func(w http.ResponseWriter, r *http.Request) {
+		if !h.admins[authedPubkey(r)] {
+			writeError(w, http.StatusForbidden, "admin access required")
+			return
+		}
+
+		next(w, r)
+	})
+}
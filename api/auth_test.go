@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testPubkey = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+func TestConsumeChallenge(t *testing.T) {
+	a := newAuthStore()
+
+	challenge, expiresAt, err := a.newChallenge()
+	if err != nil {
+		t.Fatalf("error issuing challenge: %s", err)
+	}
+	if time.Until(expiresAt) > challengeTTL {
+		t.Fatalf("challenge expires in %s, want at most %s", time.Until(expiresAt), challengeTTL)
+	}
+
+	if !a.consumeChallenge(challenge) {
+		t.Fatal("issued challenge was refused")
+	}
+	if a.consumeChallenge(challenge) {
+		t.Fatal("challenge was accepted twice")
+	}
+	if a.consumeChallenge(challengePrefix + "deadbeef") {
+		t.Fatal("challenge we never issued was accepted")
+	}
+}
+
+func TestConsumeChallengeExpired(t *testing.T) {
+	a := newAuthStore()
+
+	challenge, _, err := a.newChallenge()
+	if err != nil {
+		t.Fatalf("error issuing challenge: %s", err)
+	}
+	a.challenges[challenge] = time.Now().Add(-time.Second)
+
+	if a.consumeChallenge(challenge) {
+		t.Fatal("expired challenge was accepted")
+	}
+	if _, ok := a.challenges[challenge]; ok {
+		t.Fatal("expired challenge was kept after being used")
+	}
+}
+
+func TestLookupSession(t *testing.T) {
+	a := newAuthStore()
+
+	token, _, err := a.newSession(testPubkey)
+	if err != nil {
+		t.Fatalf("error issuing session: %s", err)
+	}
+	if pubkey, ok := a.lookupSession(token); !ok || pubkey != testPubkey {
+		t.Fatalf("lookupSession = %q, %t, want %q, true", pubkey, ok, testPubkey)
+	}
+	// Sessions, unlike challenges, can be used again.
+	if _, ok := a.lookupSession(token); !ok {
+		t.Fatal("session was only accepted once")
+	}
+
+	if _, ok := a.lookupSession("unknown"); ok {
+		t.Fatal("unknown token was accepted")
+	}
+
+	a.sessions[token] = session{pubkey: testPubkey, expiresAt: time.Now().Add(-time.Second)}
+	if _, ok := a.lookupSession(token); ok {
+		t.Fatal("expired session was accepted")
+	}
+	if _, ok := a.sessions[token]; ok {
+		t.Fatal("expired session was kept after being looked up")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	h := &Handler{auth: newAuthStore()}
+
+	token, _, err := h.auth.newSession(testPubkey)
+	if err != nil {
+		t.Fatalf("error issuing session: %s", err)
+	}
+	expired, _, err := h.auth.newSession(testPubkey)
+	if err != nil {
+		t.Fatalf("error issuing session: %s", err)
+	}
+	h.auth.sessions[expired] = session{pubkey: testPubkey, expiresAt: time.Now().Add(-time.Second)}
+
+	var gotPubkey string
+	handler := h.Auth(func(w http.ResponseWriter, r *http.Request) {
+		gotPubkey = authedPubkey(r)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"valid session", "Bearer " + token, http.StatusNoContent},
+		{"no header", "", http.StatusUnauthorized},
+		{"empty token", "Bearer ", http.StatusUnauthorized},
+		{"not a bearer token", token, http.StatusUnauthorized},
+		{"unknown token", "Bearer unknown", http.StatusUnauthorized},
+		{"expired token", "Bearer " + expired, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotPubkey = ""
+			r := httptest.NewRequest(http.MethodGet, "/v1/listChannelRequests", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, test.wantStatus)
+			}
+			if test.wantStatus != http.StatusNoContent {
+				if gotPubkey != "" {
+					t.Fatal("handler ran for a rejected request")
+				}
+				return
+			}
+			if gotPubkey != testPubkey {
+				t.Fatalf("authed pubkey %q, want %q", gotPubkey, testPubkey)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"TapHub/backend"
+)
+
+type backendKey struct{}
+
+// backend returns the backend the request was routed to, the default one
+// unless pickBackend chose another.
+func (h *Handler) backend(r *http.Request) *backend.Backend {
+	if b, ok := r.Context().Value(backendKey{}).(*backend.Backend); ok {
+		return b
+	}
+	return h.backends.Default()
+}
+
+// pickBackend routes the request to the backend named by its backend
+// parameter, or to one on the network named by its network parameter.
+// backend=all runs the request on every backend, or every backend on the
+// network, and collects the responses.
+func (h *Handler) pickBackend(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		name, network := q.Get("backend"), q.Get("network")
+
+		var b *backend.Backend
+		switch {
+		case name == backend.All:
+			h.fanOut(w, r, network, next)
+			return
+
+		case name != "":
+			var ok bool
+			b, ok = h.backends.Get(name)
+			if !ok {
+				writeErrorDetails(w, http.StatusBadRequest, map[string]any{"parameter": "backend"}, "unknown backend %q", name)
+				return
+			}
+			if network != "" && b.Network != network {
+				writeErrorDetails(w, http.StatusBadRequest, map[string]any{"parameter": "network"}, "backend %s runs on %s, not %s", name, b.Network, network)
+				return
+			}
+
+		case network != "":
+			var ok bool
+			b, ok = h.backends.ForNetwork(network)
+			if !ok {
+				writeErrorDetails(w, http.StatusBadRequest, map[string]any{"parameter": "network"}, "no backend on network %q", network)
+				return
+			}
+
+		default:
+			next(w, r)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), backendKey{}, b)))
+	}
+}
+
+// backendResult is one backend's response to a fanned out request. Data is
+// the response body on success, Error the error on failure.
+type backendResult struct {
+	Backend string          `json:"backend"`
+	Network string          `json:"network"`
+	Status  int             `json:"status"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   *apiError       `json:"error,omitempty"`
+}
+
+// bufferedResponse keeps a response in memory.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// fanOut runs the request on every backend on network, or every backend if
+// network is empty, all at once. Backends failing doesn't fail the request,
+// each one's outcome is in its result.
+func (h *Handler) fanOut(w http.ResponseWriter, r *http.Request, network string, next http.HandlerFunc) {
+	var backends []*backend.Backend
+	for _, b := range h.backends.All() {
+		if network == "" || b.Network == network {
+			backends = append(backends, b)
+		}
+	}
+	if len(backends) == 0 {
+		writeErrorDetails(w, http.StatusBadRequest, map[string]any{"parameter": "network"}, "no backend on network %q", network)
+		return
+	}
+
+	results := make([]backendResult, len(backends))
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Each backend gets its own copy of the request, so
+			// handlers and middleware touching its headers don't
+			// race. Only routes without a body fan out.
+			resp := &bufferedResponse{header: make(http.Header)}
+			next(resp, r.Clone(context.WithValue(r.Context(), backendKey{}, b)))
+
+			result := backendResult{
+				Backend: b.Name,
+				Network: b.Network,
+				Status:  resp.status,
+			}
+			if resp.status < http.StatusBadRequest {
+				result.Data = resp.body.Bytes()
+			} else {
+				var body struct {
+					Error apiError `json:"error"`
+				}
+				if err := json.Unmarshal(resp.body.Bytes(), &body); err != nil {
+					body.Error = apiError{Code: codeInternal, Message: "unreadable error response"}
+				}
+				result.Error = &body.Error
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, struct {
+		Results []backendResult `json:"results"`
+	}{
+		Results: results,
+	})
+}
+
+// ListBackends lists the lnd/tapd backends TapHub runs on and how each did
+// in its last health check.
+func (h *Handler) ListBackends(w http.ResponseWriter, r *http.Request) {
+	type backendStatus struct {
+		Name    string         `json:"name"`
+		Network string         `json:"network"`
+		Default bool           `json:"default"`
+		Health  backend.Health `json:"health"`
+	}
+
+	def := h.backends.Default()
+	backends := make([]backendStatus, 0, len(h.backends.All()))
+	for _, b := range h.backends.All() {
+		backends = append(backends, backendStatus{
+			Name:    b.Name,
+			Network: b.Network,
+			Default: b == def,
+			Health:  b.Health(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Backends []backendStatus `json:"backends"`
+	}{
+		Backends: backends,
+	})
+}
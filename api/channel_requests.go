@@ -0,0 +1,387 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"TapHub/graph"
+	"TapHub/store"
+	"TapHub/webhook"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+const (
+	// channelRequestTTL is how long the two parties have to get from a
+	// request to a completed asset channel before the request expires.
+	channelRequestTTL = 24 * time.Hour
+
+	// maxOpenChannelRequests is how many unfinished requests a buyer may
+	// have with one seller at a time.
+	maxOpenChannelRequests = 3
+)
+
+// errTransitionUnverified is returned when the graph doesn't back up a
+// requested state transition.
+var errTransitionUnverified = errors.New("transition not backed by channel graph")
+
+// CreateChannelRequest asks a listing's seller for an asset channel. A buyer
+// can only have a few unfinished requests with each seller at a time.
+func (h *Handler) CreateChannelRequest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ListingID   int64  `json:"listingId"`
+		AssetAmount uint64 `json:"assetAmount"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding channel request: %s", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	listing, err := h.store.GetListing(ctx, req.ListingID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "listing %d not found", req.ListingID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	buyer := authedPubkey(r)
+	if buyer == listing.NodePubkey {
+		writeError(w, http.StatusBadRequest, "can't request a channel from your own listing")
+		return
+	}
+	if req.AssetAmount < listing.MinAmount || req.AssetAmount > listing.MaxAmount {
+		writeError(w, http.StatusBadRequest, "assetAmount must be between %d and %d", listing.MinAmount, listing.MaxAmount)
+		return
+	}
+
+	if _, err := h.store.ExpireChannelRequests(ctx, time.Now()); err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	open, err := h.store.CountOpenChannelRequests(ctx, buyer, listing.NodePubkey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	if open >= maxOpenChannelRequests {
+		writeError(w, http.StatusConflict, "already %d open channel requests to %s, wait for one to complete or expire", open, listing.NodePubkey)
+		return
+	}
+
+	// Only channels funded after this height can fulfil the request.
+	info, err := h.lightningClient.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error getting chain height: %s", err.Error())
+		return
+	}
+
+	cr, err := h.store.CreateChannelRequest(ctx, store.ChannelRequest{
+		ListingID:     listing.ID,
+		BuyerPubkey:   buyer,
+		SellerPubkey:  listing.NodePubkey,
+		AssetID:       listing.AssetID,
+		AssetAmount:   req.AssetAmount,
+		ExpiresAt:     time.Now().Add(channelRequestTTL),
+		CreatedHeight: info.BlockHeight,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	h.notify(ctx, webhook.EventChannelRequestCreated, cr, cr.BuyerPubkey, cr.SellerPubkey)
+
+	writeJSON(w, http.StatusOK, struct {
+		ChannelRequest *store.ChannelRequest `json:"channelRequest"`
+	}{
+		ChannelRequest: cr,
+	})
+}
+
+// getPartyChannelRequest loads a channel request, hiding it from anyone
+// other than its buyer and seller.
+func (h *Handler) getPartyChannelRequest(ctx context.Context, id int64, pubkey string) (*store.ChannelRequest, error) {
+	if _, err := h.store.ExpireChannelRequests(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+
+	cr, err := h.store.GetChannelRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cr.BuyerPubkey != pubkey && cr.SellerPubkey != pubkey {
+		return nil, store.ErrNotFound
+	}
+
+	return cr, nil
+}
+
+func (h *Handler) GetChannelRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid channel request id %q", r.URL.Query().Get("id"))
+		return
+	}
+
+	cr, err := h.getPartyChannelRequest(r.Context(), id, authedPubkey(r))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "channel request %d not found", id)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		ChannelRequest *store.ChannelRequest `json:"channelRequest"`
+	}{
+		ChannelRequest: cr,
+	})
+}
+
+// ListChannelRequests returns the requests the caller is a party to.
+func (h *Handler) ListChannelRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if _, err := h.store.ExpireChannelRequests(ctx, time.Now()); err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	requests, err := h.store.ListChannelRequests(ctx, store.ChannelRequestFilter{
+		Pubkey: authedPubkey(r),
+		State:  store.ChannelRequestState(r.URL.Query().Get("state")),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		ChannelRequests []store.ChannelRequest `json:"channelRequests"`
+	}{
+		ChannelRequests: requests,
+	})
+}
+
+// AdvanceChannelRequest moves a channel request to its next state. Which
+// party may make each move is fixed, and every move has to be backed by the
+// channel graph as seen by our own lnd rather than by what the client says.
+// Sats channels whose opener we can't see are confirmed here by the seller,
+// asset channels whose funding we can't see by the buyer.
+func (h *Handler) AdvanceChannelRequest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID    int64                     `json:"id"`
+		State store.ChannelRequestState `json:"state"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding advance channel request: %s", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	pubkey := authedPubkey(r)
+	cr, err := h.getPartyChannelRequest(ctx, req.ID, pubkey)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "channel request %d not found", req.ID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	if req.State == store.StateExpired {
+		writeError(w, http.StatusBadRequest, "channel requests expire on their own")
+		return
+	}
+	if !store.CanTransition(cr.State, req.State) {
+		writeError(w, http.StatusConflict, "channel request %d can't move from %s to %s", cr.ID, cr.State, req.State)
+		return
+	}
+
+	if isBuyer := pubkey == cr.BuyerPubkey; !store.CanAdvance(req.State, isBuyer) {
+		if isBuyer {
+			writeError(w, http.StatusForbidden, "only the seller can report the asset channel")
+		} else {
+			writeError(w, http.StatusForbidden, "only the buyer can confirm the asset channel")
+		}
+		return
+	}
+
+	chanPoint, err := h.verifyTransition(ctx, cr, req.State, pubkey)
+	if errors.Is(err, errTransitionUnverified) {
+		writeError(w, http.StatusConflict, "%s", err.Error())
+		return
+	}
+	if errors.Is(err, graph.ErrNotReady) {
+		writeError(w, http.StatusServiceUnavailable, "%s", err.Error())
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "%s", err.Error())
+		return
+	}
+
+	cr, err = h.store.TransitionChannelRequest(ctx, cr.ID, cr.State, req.State, chanPoint)
+	if errors.Is(err, store.ErrStateChanged) {
+		writeError(w, http.StatusConflict, "channel request %d was updated concurrently, try again", req.ID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	h.notify(ctx, webhook.EventChannelRequestUpdated, cr, cr.BuyerPubkey, cr.SellerPubkey)
+
+	writeJSON(w, http.StatusOK, struct {
+		ChannelRequest *store.ChannelRequest `json:"channelRequest"`
+	}{
+		ChannelRequest: cr,
+	})
+}
+
+// verifyTransition checks the channel graph for the channel that justifies
+// moving cr into state to, and returns its channel point. by is the party
+// making the move, empty when the chain monitor does.
+//
+// The sats and asset channels have to be funded in a block after the
+// request was made. The sats channel has to be opened by the buyer. We
+// only know who opened channels our own node is a party to, for any other
+// the seller, whose node does know, has to be the one confirming it. Asset
+// channels are opened if we can see they are funded with the asset, which
+// again we can only for our own. Any other new channel can only be reported
+// as unverified, for the buyer to confirm.
+func (h *Handler) verifyTransition(ctx context.Context, cr *store.ChannelRequest, to store.ChannelRequestState, by string) (string, error) {
+	edges, err := h.graph.ChannelsBetween(cr.BuyerPubkey, cr.SellerPubkey)
+	if err != nil {
+		return "", err
+	}
+
+	switch to {
+	case store.StateSatsChannelSeen:
+		var minSats, maxSats uint64
+		listing, err := h.store.GetListing(ctx, cr.ListingID)
+		if err == nil {
+			minSats, maxSats = listing.MinChannelSats, listing.MaxChannelSats
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return "", err
+		}
+
+		details, err := h.newChannelsSince(ctx, cr, edges)
+		if err != nil {
+			return "", err
+		}
+
+		unknownOpener := ""
+		for _, d := range details {
+			capacity := uint64(d.Capacity)
+			if capacity < minSats || (maxSats != 0 && capacity > maxSats) {
+				continue
+			}
+			switch {
+			case d.Opener == cr.BuyerPubkey:
+				return d.ChanPoint, nil
+			case d.Opener == "" && by == cr.SellerPubkey:
+				return d.ChanPoint, nil
+			case d.Opener == "":
+				unknownOpener = d.ChanPoint
+			}
+		}
+		if unknownOpener != "" {
+			return "", fmt.Errorf("%w: can't tell who opened channel %s, the seller has to confirm it", errTransitionUnverified, unknownOpener)
+		}
+		return "", fmt.Errorf("%w: no channel opened by the buyer since the request matching the listing's channel requirements", errTransitionUnverified)
+
+	case store.StateAssetChannelOpened, store.StateAssetChannelUnverified:
+		details, err := h.newChannelsSince(ctx, cr, edges)
+		if err != nil {
+			return "", err
+		}
+
+		unknownFunding := ""
+		for _, d := range details {
+			if d.ChanPoint == cr.SatsChanPoint {
+				continue
+			}
+			switch {
+			case to == store.StateAssetChannelOpened && fundedWith(d, cr.AssetID):
+				return d.ChanPoint, nil
+			case to == store.StateAssetChannelUnverified && d.IsAssetChannel == nil:
+				return d.ChanPoint, nil
+			case d.IsAssetChannel == nil:
+				unknownFunding = d.ChanPoint
+			}
+		}
+		if unknownFunding != "" {
+			return "", fmt.Errorf("%w: can't see how channel %s is funded, report it as %s for the buyer to confirm", errTransitionUnverified, unknownFunding, store.StateAssetChannelUnverified)
+		}
+		if to == store.StateAssetChannelUnverified {
+			return "", fmt.Errorf("%w: no channel opened since the request besides the sats channel %s whose funding can't be seen", errTransitionUnverified, cr.SatsChanPoint)
+		}
+		return "", fmt.Errorf("%w: no channel opened since the request besides the sats channel %s that can be verified as funded with %s", errTransitionUnverified, cr.SatsChanPoint, cr.AssetID)
+
+	case store.StateBuyerConfirmed, store.StateCompleted:
+		if findEdge(edges, cr.AssetChanPoint) == nil {
+			return "", fmt.Errorf("%w: asset channel %s is no longer in the graph", errTransitionUnverified, cr.AssetChanPoint)
+		}
+		return cr.AssetChanPoint, nil
+	}
+
+	return "", fmt.Errorf("unknown channel request state %s", to)
+}
+
+// newChannelsSince describes the edges funded in a block after cr was made.
+// The funding height is taken from the short channel ID, so channels the
+// parties opened before the request never count, however late the monitor
+// first saw them. Requests made before their height was recorded have no new
+// channels.
+func (h *Handler) newChannelsSince(ctx context.Context, cr *store.ChannelRequest, edges []*lnrpc.ChannelEdge) ([]channelDetails, error) {
+	var fresh []*lnrpc.ChannelEdge
+	for _, edge := range edges {
+		fundingHeight := lnwire.NewShortChanIDFromInt(edge.ChannelId).BlockHeight
+		if cr.CreatedHeight > 0 && fundingHeight > cr.CreatedHeight {
+			fresh = append(fresh, edge)
+		}
+	}
+
+	return h.describeChannels(ctx, h.backends.Default(), fresh)
+}
+
+func findEdge(edges []*lnrpc.ChannelEdge, chanPoint string) *lnrpc.ChannelEdge {
+	for _, edge := range edges {
+		if edge.ChanPoint == chanPoint {
+			return edge
+		}
+	}
+
+	return nil
+}
+
+// fundedWith reports whether the channel is an asset channel funded with the
+// given asset.
+func fundedWith(d channelDetails, assetID string) bool {
+	if d.IsAssetChannel == nil || !*d.IsAssetChannel {
+		return false
+	}
+	for _, a := range d.FundingAssets {
+		if a.AssetID == assetID {
+			return true
+		}
+	}
+
+	return false
+}
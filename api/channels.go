@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"TapHub/monitor"
+	"TapHub/store"
+	"TapHub/webhook"
+)
+
+// ListChannels returns the channels the chain monitor has recorded for a
+// node, without touching lnd.
+func (h *Handler) ListChannels(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pubkey := q.Get("pubkey")
+	if pubkey == "" {
+		writeError(w, http.StatusBadRequest, "pubkey is required")
+		return
+	}
+	openOnly, _ := strconv.ParseBool(q.Get("openOnly"))
+
+	channels, err := h.store.ListChannels(r.Context(), store.ChannelFilter{
+		Pubkey:   pubkey,
+		Peer:     q.Get("peer"),
+		OpenOnly: openOnly,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Channels []store.Channel `json:"channels"`
+	}{
+		Channels: channels,
+	})
+}
+
+// watchChannels follows the chain monitor's channel events. Each one is
+// forwarded to stream clients and webhooks, and channel requests waiting on
+// a sats channel are advanced as soon as one opens between buyer and seller.
+func (h *Handler) watchChannels(ctx context.Context) {
+	events, cancel := h.monitor.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			streamType := streamChannelOpened
+			if e.Type == monitor.ChannelClosed {
+				streamType = streamChannelClosed
+			}
+			h.events.publish(streamEvent{
+				Type:    streamType,
+				Pubkeys: []string{e.Channel.Node1Pubkey, e.Channel.Node2Pubkey},
+				Data:    e.Channel,
+			})
+
+			switch e.Type {
+			case monitor.ChannelOpened:
+				h.notify(ctx, webhook.EventChannelOpened, e.Channel, e.Channel.Node1Pubkey, e.Channel.Node2Pubkey)
+				if err := h.advanceOnChannelOpen(ctx, e.Channel); err != nil {
+					fmt.Printf("error advancing channel requests for channel %s: %s\n", e.Channel.ChanPoint, err.Error())
+				}
+			case monitor.ChannelClosed:
+				h.notify(ctx, webhook.EventChannelClosed, e.Channel, e.Channel.Node1Pubkey, e.Channel.Node2Pubkey)
+			}
+		}
+	}
+}
+
+func (h *Handler) advanceOnChannelOpen(ctx context.Context, c store.Channel) error {
+	requests, err := h.store.ListChannelRequests(ctx, store.ChannelRequestFilter{
+		Pubkey: c.Node1Pubkey,
+		State:  store.StateRequested,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, cr := range requests {
+		if cr.BuyerPubkey != c.Node2Pubkey && cr.SellerPubkey != c.Node2Pubkey {
+			continue
+		}
+
+		chanPoint, err := h.verifyTransition(ctx, &cr, store.StateSatsChannelSeen, "")
+		if err != nil {
+			fmt.Printf("channel request %d not advanced: %s\n", cr.ID, err.Error())
+			continue
+		}
+		updated, err := h.store.TransitionChannelRequest(ctx, cr.ID, cr.State, store.StateSatsChannelSeen, chanPoint)
+		if err != nil {
+			fmt.Printf("channel request %d not advanced: %s\n", cr.ID, err.Error())
+			continue
+		}
+		h.notify(ctx, webhook.EventChannelRequestUpdated, updated, updated.BuyerPubkey, updated.SellerPubkey)
+		fmt.Printf("channel request %d saw sats channel %s\n", cr.ID, chanPoint)
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightninglabs/taproot-assets/rfqmsg"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Event types pushed on the live event stream.
+const (
+	streamChannelOpened = "channel_opened"
+	streamChannelClosed = "channel_closed"
+	streamInvoice       = "invoice"
+	streamPrice         = "price"
+)
+
+// streamEvent is a single event on the live event stream. Pubkeys are the
+// nodes the event concerns, the only ones it is streamed to unless it is a
+// price update. PaymentHash is what the paymentHash filter matches against.
+type streamEvent struct {
+	Type        string
+	Pubkeys     []string
+	PaymentHash string
+	Data        any
+}
+
+// eventHub fans stream events out to every connected stream client.
+type eventHub struct {
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]chan streamEvent
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: make(map[int]chan streamEvent),
+	}
+}
+
+func (e *eventHub) subscribe() (<-chan streamEvent, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := e.nextID
+	e.nextID++
+	events := make(chan streamEvent, 64)
+	e.subs[id] = events
+
+	return events, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subs[id]; ok {
+			delete(e.subs, id)
+			close(events)
+		}
+	}
+}
+
+// publish hands the event to every subscriber that has room for it. A
+// client that can't keep up misses events rather than stalling the rest.
+func (e *eventHub) publish(event streamEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, events := range e.subs {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// invoiceUpdate is the stream payload for an invoice state change, and the
+// status the invoice routes report.
+type invoiceUpdate struct {
+	PaymentHash string    `json:"paymentHash"`
+	State       string    `json:"state"`
+	Memo        string    `json:"memo"`
+	ValueSat    int64     `json:"valueSat"`
+	AmtPaidSat  int64     `json:"amtPaidSat"`
+	SettledAt   time.Time `json:"settledAt,omitzero"`
+
+	// AssetAmountSettled is the number of asset units the invoice's
+	// settled HTLCs carried, zero for plain sats invoices.
+	AssetAmountSettled uint64 `json:"assetAmountSettled"`
+}
+
+func newInvoiceUpdate(invoice *lnrpc.Invoice) invoiceUpdate {
+	u := invoiceUpdate{
+		PaymentHash:        hex.EncodeToString(invoice.RHash),
+		State:              invoice.State.String(),
+		Memo:               invoice.Memo,
+		ValueSat:           invoice.Value,
+		AmtPaidSat:         invoice.AmtPaidSat,
+		AssetAmountSettled: settledAssetAmount(invoice),
+	}
+	if invoice.SettleDate != 0 {
+		u.SettledAt = time.Unix(invoice.SettleDate, 0)
+	}
+
+	return u
+}
+
+// settledAssetAmount sums the asset units of the invoice's settled HTLCs,
+// from tapd's custom channel data on each of them.
+func settledAssetAmount(invoice *lnrpc.Invoice) uint64 {
+	var total uint64
+	for _, htlc := range invoice.Htlcs {
+		if htlc.State != lnrpc.InvoiceHTLCState_SETTLED || len(htlc.CustomChannelData) == 0 {
+			continue
+		}
+
+		var assetHtlc rfqmsg.JsonHtlc
+		if err := json.Unmarshal(htlc.CustomChannelData, &assetHtlc); err != nil {
+			fmt.Printf("error decoding custom channel data of htlc %d: %s\n", htlc.HtlcIndex, err.Error())
+			continue
+		}
+		for _, balance := range assetHtlc.Balances {
+			total += balance.Amount
+		}
+	}
+
+	return total
+}
+
+// invoiceRetryDelay is how long an invoice watch waits before subscribing
+// again after its subscription fails.
+const invoiceRetryDelay = 5 * time.Second
+
+// invoiceWatcher follows the invoice of every unfinished purchase with its
+// own subscription, until the invoice is settled or canceled. lnd's
+// SubscribeInvoices only reports invoices being added and settled, never
+// accepted or canceled ones.
+type invoiceWatcher struct {
+	invoicesClient invoicesrpc.InvoicesClient
+	store          *store.Store
+
+	// updated is called with every state the purchase's invoice is in,
+	// starting with the one it is in when the watch starts.
+	updated func(context.Context, store.Purchase, *lnrpc.Invoice)
+
+	added chan store.Purchase
+}
+
+func newInvoiceWatcher(invoicesClient invoicesrpc.InvoicesClient, db *store.Store, updated func(context.Context, store.Purchase, *lnrpc.Invoice)) *invoiceWatcher {
+	return &invoiceWatcher{
+		invoicesClient: invoicesClient,
+		store:          db,
+		updated:        updated,
+		added:          make(chan store.Purchase),
+	}
+}
+
+// watch starts following the invoice of a new purchase.
+func (iw *invoiceWatcher) watch(ctx context.Context, p store.Purchase) {
+	select {
+	case iw.added <- p:
+	case <-ctx.Done():
+	}
+}
+
+// run follows the invoice of every unfinished purchase until ctx is
+// cancelled.
+func (iw *invoiceWatcher) run(ctx context.Context) {
+	following := make(map[string]bool)
+	done := make(chan string)
+	start := func(p store.Purchase) {
+		if following[p.PaymentHash] {
+			return
+		}
+		following[p.PaymentHash] = true
+		go func() {
+			iw.follow(ctx, p)
+			select {
+			case done <- p.PaymentHash:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	purchases, err := iw.store.UnfinishedPurchases(ctx)
+	if err != nil {
+		fmt.Printf("error loading purchases to watch: %s\n", err.Error())
+	}
+	for _, p := range purchases {
+		start(p)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case p := <-iw.added:
+			start(p)
+
+		case paymentHash := <-done:
+			delete(following, paymentHash)
+		}
+	}
+}
+
+// follow reports every state of the purchase's invoice until it is final,
+// subscribing again whenever the subscription breaks.
+func (iw *invoiceWatcher) follow(ctx context.Context, p store.Purchase) {
+	hash, err := parsePaymentHash(p.PaymentHash)
+	if err != nil {
+		fmt.Printf("not watching invoice of purchase %d: %s\n", p.ID, err.Error())
+		return
+	}
+
+	for {
+		err := iw.followOnce(ctx, p, hash)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if s, ok := grpcStatus(err); ok && s.Code() == codes.NotFound {
+			fmt.Printf("invoice of purchase %d not found, no longer watching it\n", p.ID)
+			return
+		}
+		fmt.Printf("invoice subscription of purchase %d failed: %s ... retrying in %s\n", p.ID, err.Error(), invoiceRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(invoiceRetryDelay):
+		}
+	}
+}
+
+// followOnce subscribes to the purchase's invoice and reports its states
+// until it is final, returning nil once it is.
+func (iw *invoiceWatcher) followOnce(ctx context.Context, p store.Purchase, hash []byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := iw.invoicesClient.SubscribeSingleInvoice(ctx, &invoicesrpc.SubscribeSingleInvoiceRequest{
+		RHash: hash,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		invoice, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		iw.updated(ctx, p, invoice)
+		if invoice.State == lnrpc.Invoice_SETTLED || invoice.State == lnrpc.Invoice_CANCELED {
+			return nil
+		}
+	}
+}
+
+// purchaseInvoiceUpdated publishes a state of a purchase's invoice to the
+// purchase's buyer and seller, and records it on the purchase.
+func (h *Handler) purchaseInvoiceUpdated(ctx context.Context, p store.Purchase, invoice *lnrpc.Invoice) {
+	u := newInvoiceUpdate(invoice)
+	h.events.publish(streamEvent{
+		Type:        streamInvoice,
+		Pubkeys:     []string{p.BuyerPubkey, p.SellerPubkey},
+		PaymentHash: u.PaymentHash,
+		Data:        u,
+	})
+	h.recordPurchasePayment(ctx, invoice)
+}
+
+// watchPrices publishes every price update from our own price oracle.
+func (h *Handler) watchPrices(ctx context.Context) {
+	updates, cancel := h.priceOracle.SubscribePrices()
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			h.events.publish(streamEvent{
+				Type: streamPrice,
+				Data: u,
+			})
+		}
+	}
+}
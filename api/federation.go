@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
+)
+
+var syncModes = map[string]universerpc.UniverseSyncMode{
+	"":         universerpc.UniverseSyncMode_SYNC_FULL,
+	"full":     universerpc.UniverseSyncMode_SYNC_FULL,
+	"issuance": universerpc.UniverseSyncMode_SYNC_ISSUANCE_ONLY,
+}
+
+// universeSyncer runs universe syncs in the background, at most one per
+// federation server at a time, and records how each one went. Like the
+// federation routes it only works on the default backend's universe.
+type universeSyncer struct {
+	universeClient universerpc.UniverseClient
+	store          *store.Store
+
+	mu      sync.Mutex
+	running map[string]bool
+	queue   chan universeSyncJob
+}
+
+type universeSyncJob struct {
+	server string
+	mode   string
+}
+
+func newUniverseSyncer(universeClient universerpc.UniverseClient, db *store.Store) *universeSyncer {
+	return &universeSyncer{
+		universeClient: universeClient,
+		store:          db,
+		running:        make(map[string]bool),
+		queue:          make(chan universeSyncJob),
+	}
+}
+
+// start queues a sync with server. It reports false if one is already
+// running.
+func (s *universeSyncer) start(ctx context.Context, server, mode string) bool {
+	s.mu.Lock()
+	if s.running[server] {
+		s.mu.Unlock()
+		return false
+	}
+	s.running[server] = true
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- universeSyncJob{server: server, mode: mode}:
+		return true
+	case <-ctx.Done():
+		s.done(server)
+		return false
+	}
+}
+
+func (s *universeSyncer) done(server string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, server)
+}
+
+func (s *universeSyncer) isRunning(server string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running[server]
+}
+
+// run carries out queued syncs until ctx is cancelled.
+func (s *universeSyncer) run(ctx context.Context) {
+	if err := s.store.AbandonUniverseSyncs(ctx, time.Now()); err != nil {
+		log.Printf("universe: %s\n", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.queue:
+			go s.sync(ctx, job)
+		}
+	}
+}
+
+func (s *universeSyncer) sync(ctx context.Context, job universeSyncJob) {
+	defer s.done(job.server)
+
+	u := store.UniverseSync{
+		Server:    job.server,
+		Mode:      job.mode,
+		StartedAt: time.Now(),
+	}
+	id, err := s.store.StartUniverseSync(ctx, job.server, job.mode, u.StartedAt)
+	if err != nil {
+		log.Printf("universe: %s\n", err)
+		return
+	}
+	u.ID = id
+
+	resp, err := s.universeClient.SyncUniverse(ctx, &universerpc.SyncRequest{
+		UniverseHost: job.server,
+		SyncMode:     syncModes[job.mode],
+	})
+	u.FinishedAt = time.Now()
+	if err != nil {
+		log.Printf("universe: sync with %s failed: %s\n", job.server, err)
+		u.Error = err.Error()
+	} else {
+		u.Universes = len(resp.SyncedUniverses)
+		u.Synced = make(map[string]int, len(resp.SyncedUniverses))
+		for _, synced := range resp.SyncedUniverses {
+			u.NewLeaves += len(synced.NewAssetLeaves)
+			if key := universeKey(synced.GetNewAssetRoot().GetId()); key != "" {
+				u.Synced[key] += len(synced.NewAssetLeaves)
+			}
+		}
+		log.Printf("universe: synced %d universes with %d new leaves from %s\n", u.Universes, u.NewLeaves, job.server)
+	}
+
+	// Record the outcome even if we're shutting down mid-sync.
+	if err := s.store.FinishUniverseSync(context.WithoutCancel(ctx), u); err != nil {
+		log.Printf("universe: %s\n", err)
+	}
+}
+
+// federationServer is a federation server along with how syncing with it
+// last went.
+type federationServer struct {
+	ID       int32               `json:"id"`
+	Host     string              `json:"host"`
+	Syncing  bool                `json:"syncing"`
+	LastSync *store.UniverseSync `json:"lastSync"`
+}
+
+func (h *Handler) ListFederationServers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	resp, err := h.universeClient.ListFederationServers(ctx, &universerpc.ListFederationServersRequest{})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error listing federation servers: %s", err.Error())
+		return
+	}
+	lastSyncs, err := h.store.LastUniverseSyncs(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	servers := make([]federationServer, 0, len(resp.Servers))
+	for _, srv := range resp.Servers {
+		fs := federationServer{
+			ID:      srv.Id,
+			Host:    srv.Host,
+			Syncing: h.universeSyncer.isRunning(srv.Host),
+		}
+		if last, ok := lastSyncs[srv.Host]; ok {
+			fs.LastSync = &last
+		}
+		servers = append(servers, fs)
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Servers []federationServer `json:"servers"`
+	}{
+		Servers: servers,
+	})
+}
+
+func (h *Handler) AddFederationServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Hosts []string `json:"hosts"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding add federation server request: %s", err.Error())
+		return
+	}
+	if len(req.Hosts) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one host is required")
+		return
+	}
+
+	servers := make([]*universerpc.UniverseFederationServer, 0, len(req.Hosts))
+	for _, host := range req.Hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			writeError(w, http.StatusBadRequest, "hosts can't be empty")
+			return
+		}
+		servers = append(servers, &universerpc.UniverseFederationServer{Host: host})
+	}
+
+	_, err = h.universeClient.AddFederationServer(r.Context(), &universerpc.AddFederationServerRequest{
+		Servers: servers,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadRequest, "error adding federation servers: %s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{
+		Success: true,
+	})
+}
+
+func (h *Handler) DeleteFederationServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Host string `json:"host"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding delete federation server request: %s", err.Error())
+		return
+	}
+	if req.Host == "" {
+		writeError(w, http.StatusBadRequest, "host is required")
+		return
+	}
+
+	_, err = h.universeClient.DeleteFederationServer(r.Context(), &universerpc.DeleteFederationServerRequest{
+		Servers: []*universerpc.UniverseFederationServer{{Host: req.Host}},
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error deleting federation server: %s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{
+		Success: true,
+	})
+}
+
+// SyncUniverse starts syncing our universe with a federation server, or with
+// every federation server if no host is given, which is a conflict if there
+// are none. Syncs run in the background, their progress is reported by
+// /listFederationServers and /listUniverseSyncs.
+func (h *Handler) SyncUniverse(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Host string `json:"host"`
+		Mode string `json:"mode"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding sync universe request: %s", err.Error())
+		return
+	}
+	if _, ok := syncModes[req.Mode]; !ok {
+		writeError(w, http.StatusBadRequest, "invalid mode %q, expected full or issuance", req.Mode)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "full"
+	}
+
+	ctx := r.Context()
+	hosts := []string{req.Host}
+	if req.Host == "" {
+		resp, err := h.universeClient.ListFederationServers(ctx, &universerpc.ListFederationServersRequest{})
+		if err != nil {
+			writeUpstreamError(w, err, http.StatusBadGateway, "error listing federation servers: %s", err.Error())
+			return
+		}
+		hosts = hosts[:0]
+		for _, srv := range resp.Servers {
+			hosts = append(hosts, srv.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		writeError(w, http.StatusConflict, "no federation servers to sync with, add one first")
+		return
+	}
+
+	started, alreadyRunning := []string{}, []string{}
+	for _, host := range hosts {
+		if h.universeSyncer.start(ctx, host, req.Mode) {
+			started = append(started, host)
+		} else {
+			alreadyRunning = append(alreadyRunning, host)
+		}
+	}
+	if len(started) == 0 && len(alreadyRunning) > 0 {
+		writeErrorDetails(w, http.StatusConflict, map[string]any{
+			"alreadyRunning": alreadyRunning,
+		}, "already syncing with %s", strings.Join(alreadyRunning, ", "))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, struct {
+		Started        []string `json:"started"`
+		AlreadyRunning []string `json:"alreadyRunning"`
+	}{
+		Started:        started,
+		AlreadyRunning: alreadyRunning,
+	})
+}
+
+// ListUniverseSyncs returns the most recent syncs, optionally only those with
+// ?server=.
+func (h *Handler) ListUniverseSyncs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit %q, must be between 1 and %d", l, maxPageLimit)
+			return
+		}
+		limit = n
+	}
+
+	syncs, err := h.store.ListUniverseSyncs(r.Context(), q.Get("server"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Syncs []store.UniverseSync `json:"syncs"`
+	}{
+		Syncs: syncs,
+	})
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"TapHub/backend"
+
+	"github.com/lightninglabs/taproot-assets/rfqmsg"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// nodeAlias returns the alias the node announced, or "" if the graph doesn't
+// know it.
+func (h *Handler) nodeAlias(pubkey string) string {
+	node, ok, err := h.graph.Node(pubkey)
+	if err != nil {
+		fmt.Printf("error finding alias of %s: %s\n", pubkey, err.Error())
+		return ""
+	}
+	if !ok {
+		return ""
+	}
+
+	return node.Alias
+}
+
+// routingPolicy is one side's forwarding policy on a channel.
+type routingPolicy struct {
+	FeeBaseMsat      int64     `json:"feeBaseMsat"`
+	FeeRateMilliMsat int64     `json:"feeRateMilliMsat"`
+	TimeLockDelta    uint32    `json:"timeLockDelta"`
+	MinHtlcMsat      int64     `json:"minHtlcMsat"`
+	MaxHtlcMsat      uint64    `json:"maxHtlcMsat"`
+	Disabled         bool      `json:"disabled"`
+	LastUpdate       time.Time `json:"lastUpdate"`
+}
+
+func newRoutingPolicy(p *lnrpc.RoutingPolicy) *routingPolicy {
+	if p == nil {
+		return nil
+	}
+
+	return &routingPolicy{
+		FeeBaseMsat:      p.FeeBaseMsat,
+		FeeRateMilliMsat: p.FeeRateMilliMsat,
+		TimeLockDelta:    p.TimeLockDelta,
+		MinHtlcMsat:      p.MinHtlc,
+		MaxHtlcMsat:      p.MaxHtlcMsat,
+		Disabled:         p.Disabled,
+		LastUpdate:       time.Unix(int64(p.LastUpdate), 0),
+	}
+}
+
+// channelAsset is an asset committed to a Taproot Asset channel at funding.
+type channelAsset struct {
+	AssetID        string `json:"assetId"`
+	Name           string `json:"name"`
+	Amount         uint64 `json:"amount"`
+	DecimalDisplay uint8  `json:"decimalDisplay"`
+}
+
+// channelDetails describes a channel as seen from the graph, filled in with
+// what our own node knows when it is one of the parties.
+type channelDetails struct {
+	ChanPoint   string         `json:"chanPoint"`
+	ChannelID   uint64         `json:"channelId,string"`
+	Capacity    int64          `json:"capacity"`
+	Node1Pubkey string         `json:"node1Pubkey"`
+	Node2Pubkey string         `json:"node2Pubkey"`
+	LastUpdate  time.Time      `json:"lastUpdate"`
+	Node1Policy *routingPolicy `json:"node1Policy"`
+	Node2Policy *routingPolicy `json:"node2Policy"`
+
+	// Opener is the node that funded the channel. It is only known for
+	// our own channels.
+	Opener string `json:"opener,omitempty"`
+
+	// Private is only ever true for our own channels, other nodes'
+	// unannounced channels never reach our graph.
+	Private bool `json:"private"`
+
+	// IsAssetChannel is nil when we can't tell, which is the case for
+	// every channel our node isn't a party to.
+	IsAssetChannel *bool          `json:"isAssetChannel"`
+	GroupKey       string         `json:"groupKey,omitempty"`
+	FundingAssets  []channelAsset `json:"fundingAssets,omitempty"`
+}
+
+// identityPubkey returns the pubkey of the backend's lnd, looking it up on
+// first use.
+func (h *Handler) identityPubkey(ctx context.Context, b *backend.Backend) (string, error) {
+	h.identityMu.Lock()
+	defer h.identityMu.Unlock()
+
+	if h.identities[b.Name] == "" {
+		info, err := b.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+		if err != nil {
+			return "", fmt.Errorf("error getting node info: %w", err)
+		}
+		h.identities[b.Name] = info.IdentityPubkey
+	}
+
+	return h.identities[b.Name], nil
+}
+
+// describeChannels turns graph edges into channel details. For edges the
+// backend's node is a party to, its lnd's view of the channel adds the
+// opener, whether it is private and, from tapd's custom channel data, the
+// assets funding it.
+func (h *Handler) describeChannels(ctx context.Context, b *backend.Backend, edges []*lnrpc.ChannelEdge) ([]channelDetails, error) {
+	self, err := h.identityPubkey(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	var own map[string]*lnrpc.Channel
+	details := make([]channelDetails, 0, len(edges))
+	for _, edge := range edges {
+		d := channelDetails{
+			ChanPoint:   edge.ChanPoint,
+			ChannelID:   edge.ChannelId,
+			Capacity:    edge.Capacity,
+			Node1Pubkey: edge.Node1Pub,
+			Node2Pubkey: edge.Node2Pub,
+			LastUpdate:  time.Unix(int64(edge.LastUpdate), 0),
+			Node1Policy: newRoutingPolicy(edge.Node1Policy),
+			Node2Policy: newRoutingPolicy(edge.Node2Policy),
+		}
+
+		if edge.Node1Pub == self || edge.Node2Pub == self {
+			if own == nil {
+				channels, err := b.Lightning.ListChannels(ctx, &lnrpc.ListChannelsRequest{})
+				if err != nil {
+					return nil, fmt.Errorf("error listing channels: %w", err)
+				}
+				own = make(map[string]*lnrpc.Channel, len(channels.Channels))
+				for _, c := range channels.Channels {
+					own[c.ChannelPoint] = c
+				}
+			}
+			if c, ok := own[edge.ChanPoint]; ok {
+				fillOwnChannel(&d, c, self)
+			}
+		}
+
+		details = append(details, d)
+	}
+
+	return details, nil
+}
+
+func fillOwnChannel(d *channelDetails, c *lnrpc.Channel, self string) {
+	d.Opener = c.RemotePubkey
+	if c.Initiator {
+		d.Opener = self
+	}
+	d.Private = c.Private
+
+	isAssetChannel := false
+	d.IsAssetChannel = &isAssetChannel
+	if len(c.CustomChannelData) == 0 {
+		return
+	}
+
+	var assetChannel rfqmsg.JsonAssetChannel
+	if err := json.Unmarshal(c.CustomChannelData, &assetChannel); err != nil {
+		fmt.Printf("error decoding custom channel data of %s: %s\n", c.ChannelPoint, err.Error())
+		return
+	}
+	if len(assetChannel.FundingAssets) == 0 {
+		return
+	}
+
+	isAssetChannel = true
+	d.GroupKey = assetChannel.GroupKey
+	for _, utxo := range assetChannel.FundingAssets {
+		d.FundingAssets = append(d.FundingAssets, channelAsset{
+			AssetID:        utxo.AssetGenesis.AssetID,
+			Name:           utxo.AssetGenesis.Name,
+			Amount:         utxo.Amount,
+			DecimalDisplay: utxo.DecimalDisplay,
+		})
+	}
+}
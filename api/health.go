@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"TapHub/backend"
+	"TapHub/store"
+)
+
+const (
+	// readinessCacheTTL is how long a readiness check is answered from
+	// cache, so probes don't call lnd and tapd on every request.
+	readinessCacheTTL = 5 * time.Second
+
+	// dbPingTimeout bounds the database part of a readiness check.
+	dbPingTimeout = 2 * time.Second
+
+	// maxPriceAge is how old our oracle's prices may get before we stop
+	// being ready. Prices are refreshed every 5 minutes, this allows for
+	// a couple of failed refreshes.
+	maxPriceAge = 15 * time.Minute
+)
+
+// lndReadiness is how the default backend's lnd answered GetInfo.
+type lndReadiness struct {
+	backend.DaemonHealth
+	Backend        string `json:"backend"`
+	BlockHeight    uint32 `json:"blockHeight,omitempty"`
+	IdentityPubkey string `json:"identityPubkey,omitempty"`
+}
+
+// universeReadiness is the most recent sync of our universe with any
+// federation server. Syncs are started by admins, so an old or failed one
+// doesn't make us unready.
+type universeReadiness struct {
+	LastSync   *store.UniverseSync `json:"lastSync,omitempty"`
+	AgeSeconds int64               `json:"ageSeconds,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// oracleReadiness is when our own price oracle last refreshed its prices.
+type oracleReadiness struct {
+	OK              bool      `json:"ok"`
+	Enabled         bool      `json:"enabled"`
+	LastPriceUpdate time.Time `json:"lastPriceUpdate,omitzero"`
+	AgeSeconds      int64     `json:"ageSeconds,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+type databaseReadiness struct {
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readinessReport is the outcome of a readiness check. We are ready when lnd
+// and tapd are up and synced, the database answers and, if we run a price
+// oracle, its prices are fresh.
+type readinessReport struct {
+	Ready     bool                 `json:"ready"`
+	CheckedAt time.Time            `json:"checkedAt"`
+	Lnd       lndReadiness         `json:"lnd"`
+	Tapd      backend.DaemonHealth `json:"tapd"`
+	Universe  universeReadiness    `json:"universe"`
+	Oracle    oracleReadiness      `json:"oracle"`
+	Database  databaseReadiness    `json:"database"`
+}
+
+// readinessCache keeps the last readiness report. Probes arriving while a
+// check runs wait for it rather than starting their own.
+type readinessCache struct {
+	mu     sync.Mutex
+	report *readinessReport
+}
+
+func newReadinessCache() *readinessCache {
+	return &readinessCache{}
+}
+
+// get returns the cached report, running check first if it has expired.
+func (c *readinessCache) get(ctx context.Context, check func(context.Context) *readinessReport) *readinessReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report == nil || time.Since(c.report.CheckedAt) > readinessCacheTTL {
+		c.report = check(ctx)
+	}
+
+	return c.report
+}
+
+// checkReadiness checks everything we depend on.
+func (h *Handler) checkReadiness(ctx context.Context) *readinessReport {
+	now := time.Now()
+	report := &readinessReport{CheckedAt: now}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		def := h.backends.Default()
+		health := def.Check(ctx)
+		report.Lnd = lndReadiness{
+			DaemonHealth:   health.Lnd,
+			Backend:        def.Name,
+			BlockHeight:    health.BlockHeight,
+			IdentityPubkey: health.IdentityPubkey,
+		}
+		report.Tapd = health.Tapd
+	}()
+
+	pingCtx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := h.store.Ping(pingCtx)
+	report.Database.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		report.Database.Error = err.Error()
+	} else {
+		report.Database.OK = true
+		report.Universe = h.universeReadiness(pingCtx, now)
+	}
+
+	report.Oracle = h.oracleReadiness(now)
+	wg.Wait()
+
+	report.Ready = report.Lnd.Synced && report.Tapd.Synced &&
+		report.Database.OK && report.Oracle.OK
+
+	return report
+}
+
+func (h *Handler) universeReadiness(ctx context.Context, now time.Time) universeReadiness {
+	syncs, err := h.store.LastUniverseSyncs(ctx)
+	if err != nil {
+		return universeReadiness{Error: err.Error()}
+	}
+
+	var u universeReadiness
+	for _, s := range syncs {
+		if u.LastSync == nil || s.StartedAt.After(u.LastSync.StartedAt) {
+			u.LastSync = &s
+		}
+	}
+	if u.LastSync != nil {
+		u.AgeSeconds = int64(now.Sub(u.LastSync.StartedAt).Seconds())
+	}
+
+	return u
+}
+
+func (h *Handler) oracleReadiness(now time.Time) oracleReadiness {
+	// Without RFQ enabled there is no oracle to depend on.
+	if h.oracle == nil {
+		return oracleReadiness{OK: true}
+	}
+
+	o := oracleReadiness{
+		Enabled:         true,
+		LastPriceUpdate: h.priceOracle.GetLastPriceUpdate(),
+	}
+	switch {
+	case o.LastPriceUpdate.IsZero():
+		o.Error = "no prices fetched yet"
+	default:
+		age := now.Sub(o.LastPriceUpdate)
+		o.AgeSeconds = int64(age.Seconds())
+		if age > maxPriceAge {
+			o.Error = "prices older than " + maxPriceAge.String()
+		} else {
+			o.OK = true
+		}
+	}
+
+	return o
+}
+
+// Live reports that the server is up and serving requests. It checks
+// nothing else, so orchestrators only restart us when we stop answering.
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{
+		Status: "ok",
+	})
+}
+
+// Ready reports whether we can serve requests that need lnd, tapd, the
+// database or our price oracle, with 503 if not. Checks are cached for
+// readinessCacheTTL.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	// A probe giving up shouldn't fail the check for the ones waiting on
+	// it, the checks have their own timeouts.
+	report := h.readiness.get(context.WithoutCancel(r.Context()), h.checkReadiness)
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,468 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"TapHub/backend"
+	"TapHub/store"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/assetwalletrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
+)
+
+const (
+	// holdingsChallengeTTL is how long an issued holdings challenge may be
+	// signed and submitted to /verifyHoldings.
+	holdingsChallengeTTL = 5 * time.Minute
+
+	// utxoLookupTimeout bounds the lookup of the proven output in the
+	// UTXO set.
+	utxoLookupTimeout = 10 * time.Second
+
+	// spendRetryDelay is how long a holdings watch waits before
+	// registering again after its spend subscription fails.
+	spendRetryDelay = 5 * time.Second
+)
+
+// errOutpointSpent is returned when the output a holdings proof commits to
+// has already been spent.
+var errOutpointSpent = errors.New("outpoint already spent")
+
+type holdingsChallenge struct {
+	pubkey    string
+	listingID int64
+	expiresAt time.Time
+}
+
+// holdingsChallenges keeps the outstanding holdings challenges. Like login
+// challenges, each can only be redeemed once, and only by the node it was
+// issued to for the listing it was issued for.
+type holdingsChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]holdingsChallenge
+}
+
+func newHoldingsChallenges() *holdingsChallenges {
+	return &holdingsChallenges{
+		challenges: make(map[string]holdingsChallenge),
+	}
+}
+
+func (c *holdingsChallenges) issue(pubkey string, listingID int64) (string, time.Time, error) {
+	challenge, err := randomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(holdingsChallengeTTL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, hc := range c.challenges {
+		if now.After(hc.expiresAt) {
+			delete(c.challenges, k)
+		}
+	}
+	c.challenges[challenge] = holdingsChallenge{
+		pubkey:    pubkey,
+		listingID: listingID,
+		expiresAt: expiresAt,
+	}
+
+	return challenge, expiresAt, nil
+}
+
+func (c *holdingsChallenges) consume(challenge, pubkey string, listingID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hc, ok := c.challenges[challenge]
+	if !ok {
+		return false
+	}
+	delete(c.challenges, challenge)
+
+	return hc.pubkey == pubkey && hc.listingID == listingID &&
+		time.Now().Before(hc.expiresAt)
+}
+
+// holdingsWatcher watches the outputs behind verified holdings and revokes
+// the verification as soon as one is spent.
+type holdingsWatcher struct {
+	chainClient chainrpc.ChainNotifierClient
+	store       *store.Store
+
+	added   chan store.Holdings
+	removed chan int64
+}
+
+func newHoldingsWatcher(chainClient chainrpc.ChainNotifierClient, db *store.Store) *holdingsWatcher {
+	return &holdingsWatcher{
+		chainClient: chainClient,
+		store:       db,
+		added:       make(chan store.Holdings),
+		removed:     make(chan int64),
+	}
+}
+
+// watch starts watching freshly verified holdings, replacing any earlier
+// watch for the same listing.
+func (hw *holdingsWatcher) watch(ctx context.Context, h store.Holdings) {
+	select {
+	case hw.added <- h:
+	case <-ctx.Done():
+	}
+}
+
+// unwatch stops watching the holdings of a deleted listing.
+func (hw *holdingsWatcher) unwatch(ctx context.Context, listingID int64) {
+	select {
+	case hw.removed <- listingID:
+	case <-ctx.Done():
+	}
+}
+
+// run watches every unspent holdings proof until ctx is cancelled.
+func (hw *holdingsWatcher) run(ctx context.Context) {
+	cancels := make(map[int64]context.CancelFunc)
+	start := func(h store.Holdings) {
+		if cancel, ok := cancels[h.ListingID]; ok {
+			cancel()
+		}
+		watchCtx, cancel := context.WithCancel(ctx)
+		cancels[h.ListingID] = cancel
+		go hw.follow(watchCtx, h)
+	}
+
+	holdings, err := hw.store.ListUnspentHoldings(ctx)
+	if err != nil {
+		log.Printf("holdings: error loading holdings to watch: %s\n", err)
+	}
+	for _, h := range holdings {
+		start(h)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case h := <-hw.added:
+			start(h)
+
+		case listingID := <-hw.removed:
+			if cancel, ok := cancels[listingID]; ok {
+				cancel()
+				delete(cancels, listingID)
+			}
+		}
+	}
+}
+
+func (hw *holdingsWatcher) follow(ctx context.Context, h store.Holdings) {
+	for {
+		spend, err := waitForSpend(ctx, hw.chainClient, h.Outpoint, h.PkScript, h.BlockHeight)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("holdings: error watching %s for spends: %s ... retrying in %s\n", h.Outpoint, err, spendRetryDelay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(spendRetryDelay):
+			}
+			continue
+		}
+
+		revoked, err := hw.store.MarkHoldingsSpent(ctx, h.ListingID, h.Outpoint, time.Now())
+		if err != nil {
+			log.Printf("holdings: error revoking holdings of listing %d: %s\n", h.ListingID, err)
+			return
+		}
+		if revoked {
+			log.Printf("holdings: %s spent at height %d, listing %d is no longer holdings verified\n", h.Outpoint, spend.SpendingHeight, h.ListingID)
+		}
+		return
+	}
+}
+
+// waitForSpend blocks until lnd reports the output spent, or ctx is done.
+func waitForSpend(ctx context.Context, chainClient chainrpc.ChainNotifierClient, outpoint string, pkScript []byte, heightHint uint32) (*chainrpc.SpendDetails, error) {
+	op, err := wire.NewOutPointFromString(outpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outpoint %s: %w", outpoint, err)
+	}
+
+	stream, err := chainClient.RegisterSpendNtfn(ctx, &chainrpc.SpendRequest{
+		Outpoint: &chainrpc.Outpoint{
+			Hash:  op.Hash[:],
+			Index: op.Index,
+		},
+		Script:     pkScript,
+		HeightHint: heightHint,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if spend := event.GetSpend(); spend != nil {
+			return spend, nil
+		}
+	}
+}
+
+// checkUnspent returns errOutpointSpent unless the output is in the UTXO set
+// of the default backend's bitcoind. Once verified, the output is watched
+// through lnd, which revokes the verification when it is spent.
+func (h *Handler) checkUnspent(ctx context.Context, outpoint string) error {
+	op, err := wire.NewOutPointFromString(outpoint)
+	if err != nil {
+		return fmt.Errorf("invalid outpoint %s: %w", outpoint, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, utxoLookupTimeout)
+	defer cancel()
+
+	unspent, err := h.backends.Default().Unspent(ctx, *op)
+	if err != nil {
+		return err
+	}
+	if !unspent {
+		return errOutpointSpent
+	}
+
+	return nil
+}
+
+// anchorPkScript returns the output script of the anchor output an asset
+// proof commits to.
+func anchorPkScript(anchor *taprpc.AnchorInfo) ([]byte, error) {
+	op, err := wire.NewOutPointFromString(anchor.AnchorOutpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid anchor outpoint %s: %w", anchor.AnchorOutpoint, err)
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(anchor.AnchorTx)); err != nil {
+		return nil, fmt.Errorf("error decoding anchor transaction: %w", err)
+	}
+	if tx.TxHash() != op.Hash || int(op.Index) >= len(tx.TxOut) {
+		return nil, fmt.Errorf("anchor transaction doesn't contain %s", anchor.AnchorOutpoint)
+	}
+
+	return tx.TxOut[op.Index].PkScript, nil
+}
+
+// CreateHoldingsChallenge issues a challenge for the caller to prove it
+// still holds the asset of one of its listings. The challenge is signed with
+// the asset's script key using tapd's ProveAssetOwnership, e.g.
+// `tapcli assets proveownership --challenge <challenge> ...`.
+func (h *Handler) CreateHoldingsChallenge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ListingID int64 `json:"listingId"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding holdings challenge request: %s", err.Error())
+		return
+	}
+
+	pubkey := authedPubkey(r)
+	listing, err := h.store.GetListing(r.Context(), req.ListingID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && listing.NodePubkey != pubkey) {
+		writeError(w, http.StatusNotFound, "listing %d not found", req.ListingID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	challenge, expiresAt, err := h.holdingsChallenges.issue(pubkey, listing.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "error generating challenge: %s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		ListingID int64     `json:"listingId"`
+		AssetID   string    `json:"assetId"`
+		Challenge string    `json:"challenge"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}{
+		ListingID: listing.ID,
+		AssetID:   listing.AssetID,
+		Challenge: challenge,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// VerifyHoldings checks an ownership proof signed over a holdings challenge.
+// The proof has to be for the listed asset, cover at least the listing's
+// minimum amount and commit to an output that is still unspent. If it does,
+// the listing is marked holdings verified until that output is spent.
+// Whether the proof passed these checks counts towards the node's
+// reputation.
+func (h *Handler) VerifyHoldings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ListingID        int64  `json:"listingId"`
+		Challenge        string `json:"challenge"`
+		ProofWithWitness string `json:"proofWithWitness"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding verify holdings request: %s", err.Error())
+		return
+	}
+
+	pubkey := authedPubkey(r)
+	if !h.holdingsChallenges.consume(req.Challenge, pubkey, req.ListingID) {
+		writeError(w, http.StatusUnauthorized, "unknown or expired challenge")
+		return
+	}
+	challenge, err := hex.DecodeString(req.Challenge)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid challenge")
+		return
+	}
+	proof, err := hex.DecodeString(req.ProofWithWitness)
+	if err != nil || len(proof) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid proofWithWitness, expected hex")
+		return
+	}
+
+	ctx := r.Context()
+	listing, err := h.store.GetListing(ctx, req.ListingID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && listing.NodePubkey != pubkey) {
+		writeError(w, http.StatusNotFound, "listing %d not found", req.ListingID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	// The slot is only needed for the calls to tapd, not for looking up
+	// the output.
+	release, ok := h.acquireTapdSlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	ownership, err := h.assetWalletClient.VerifyAssetOwnership(ctx, &assetwalletrpc.VerifyAssetOwnershipRequest{
+		ProofWithWitness: proof,
+		Challenge:        challenge,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadRequest, "verify ownership failed: %s", err.Error())
+		return
+	}
+	if !ownership.ValidProof {
+		h.recordHoldingsVerification(ctx, listing, "ownership proof is not valid")
+		writeError(w, http.StatusBadRequest, "ownership proof is not valid")
+		return
+	}
+
+	decoded, err := h.tapClient.DecodeProof(ctx, &taprpc.DecodeProofRequest{
+		RawProof: proof,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadRequest, "error decoding ownership proof: %s", err.Error())
+		return
+	}
+	release()
+	asset := decoded.DecodedProof.GetAsset()
+	if asset.GetAssetGenesis() == nil || asset.GetChainAnchor() == nil {
+		h.recordHoldingsVerification(ctx, listing, "ownership proof has no anchored asset")
+		writeError(w, http.StatusBadRequest, "ownership proof has no anchored asset")
+		return
+	}
+
+	assetID := hex.EncodeToString(asset.AssetGenesis.AssetId)
+	if !strings.EqualFold(assetID, listing.AssetID) {
+		h.recordHoldingsVerification(ctx, listing, "proof is for another asset")
+		writeError(w, http.StatusBadRequest, "proof is for asset %s, not the listed %s", assetID, listing.AssetID)
+		return
+	}
+	if asset.Amount < listing.MinAmount {
+		h.recordHoldingsVerification(ctx, listing, "proven amount is below the listing minimum")
+		writeError(w, http.StatusBadRequest, "proven amount %d is below the listing minimum of %d", asset.Amount, listing.MinAmount)
+		return
+	}
+
+	anchor := asset.ChainAnchor
+	if ownership.OutpointStr != "" && ownership.OutpointStr != anchor.AnchorOutpoint {
+		h.recordHoldingsVerification(ctx, listing, "ownership proof commits to another outpoint")
+		writeError(w, http.StatusBadRequest, "ownership proof commits to %s, not %s", ownership.OutpointStr, anchor.AnchorOutpoint)
+		return
+	}
+	pkScript, err := anchorPkScript(anchor)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	err = h.checkUnspent(ctx, anchor.AnchorOutpoint)
+	if errors.Is(err, errOutpointSpent) {
+		h.recordHoldingsVerification(ctx, listing, "outpoint already spent")
+		writeError(w, http.StatusBadRequest, "%s has already been spent", anchor.AnchorOutpoint)
+		return
+	}
+	if errors.Is(err, backend.ErrNoBitcoind) {
+		writeError(w, http.StatusServiceUnavailable, "holdings can't be verified, TapHub has no bitcoind to look up outputs in")
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "%s", err.Error())
+		return
+	}
+
+	holdings := store.Holdings{
+		ListingID:   listing.ID,
+		Outpoint:    anchor.AnchorOutpoint,
+		PkScript:    pkScript,
+		ScriptKey:   hex.EncodeToString(asset.ScriptKey),
+		Amount:      asset.Amount,
+		BlockHeight: anchor.BlockHeight,
+		VerifiedAt:  time.Now(),
+	}
+	if err := h.store.RecordHoldings(ctx, holdings); err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	h.holdings.watch(ctx, holdings)
+	h.recordHoldingsVerification(ctx, listing, "")
+
+	listing, err = h.store.GetListing(ctx, listing.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Listing *store.Listing `json:"listing"`
+	}{
+		Listing: listing,
+	})
+}
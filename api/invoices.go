@@ -0,0 +1,329 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightninglabs/taproot-assets/taprpc/rfqrpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/tapchannelrpc"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"google.golang.org/grpc/codes"
+)
+
+// invoiceExpiry is how long an asset invoice can be paid for. The buy quote
+// behind it usually runs out sooner.
+const invoiceExpiry = 5 * time.Minute
+
+// assetInvoice is an invoice for receiving asset units over an asset
+// channel, and the buy quote its sats amount was worked out from.
+type assetInvoice struct {
+	PaymentRequest string   `json:"paymentRequest"`
+	PaymentHash    string   `json:"paymentHash"`
+	PaymentAddr    string   `json:"paymentAddr"`
+	AddIndex       uint64   `json:"addIndex"`
+	AssetID        string   `json:"assetId"`
+	AssetAmount    uint64   `json:"assetAmount"`
+	ValueSat       int64    `json:"valueSat"`
+	Quote          buyQuote `json:"quote"`
+
+	// PurchaseID is the ledger entry tracking the purchase.
+	PurchaseID int64 `json:"purchaseId"`
+}
+
+// buyQuote is a quote the peer accepted for selling us asset units.
+type buyQuote struct {
+	ID   string `json:"id"`
+	Peer string `json:"peer"`
+
+	// Rate is the number of asset units per BTC, as the fixed point
+	// number Coefficient / 10^Scale.
+	Rate fixedPoint `json:"rate"`
+
+	// Scid is the short channel ID payments under the quote are routed
+	// through.
+	Scid uint64 `json:"scid"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type fixedPoint struct {
+	Coefficient string `json:"coefficient"`
+	Scale       uint32 `json:"scale"`
+}
+
+func newBuyQuote(q *rfqrpc.PeerAcceptedBuyQuote) buyQuote {
+	return buyQuote{
+		ID:   hex.EncodeToString(q.Id),
+		Peer: q.Peer,
+		Rate: fixedPoint{
+			Coefficient: q.AskAssetRate.GetCoefficient(),
+			Scale:       q.AskAssetRate.GetScale(),
+		},
+		Scid:      q.Scid,
+		ExpiresAt: time.Unix(int64(q.Expiry), 0).UTC(),
+	}
+}
+
+// CreateInvoice creates an invoice for buying asset units from a listing.
+// Our tapd asks the listing's node for a buy quote and sizes the invoice
+// from it, so the invoice is paid in sats and settled in the asset over
+// the node's asset channel.
+func (h *Handler) CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ListingID   int64  `json:"listingId"`
+		AssetAmount uint64 `json:"assetAmount"`
+		Memo        string `json:"memo"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding create invoice request: %s", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	listing, err := h.store.GetListing(ctx, req.ListingID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "listing %d not found", req.ListingID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	if authedPubkey(r) == listing.NodePubkey {
+		writeError(w, http.StatusBadRequest, "can't buy from your own listing")
+		return
+	}
+	if req.AssetAmount < listing.MinAmount || req.AssetAmount > listing.MaxAmount {
+		writeError(w, http.StatusBadRequest, "assetAmount must be between %d and %d", listing.MinAmount, listing.MaxAmount)
+		return
+	}
+
+	assetID, err := hex.DecodeString(listing.AssetID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "listing %d has invalid asset id %q", listing.ID, listing.AssetID)
+		return
+	}
+	peer, err := hex.DecodeString(listing.NodePubkey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "listing %d has invalid node pubkey %q", listing.ID, listing.NodePubkey)
+		return
+	}
+
+	resp, err := h.tapChannelClient.AddInvoice(ctx, &tapchannelrpc.AddInvoiceRequest{
+		AssetId:     assetID,
+		AssetAmount: req.AssetAmount,
+		PeerPubkey:  peer,
+		InvoiceRequest: &lnrpc.Invoice{
+			Memo:   req.Memo,
+			Expiry: int64(invoiceExpiry.Seconds()),
+		},
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error creating asset invoice: %s", err.Error())
+		return
+	}
+	if resp.AcceptedBuyQuote == nil || resp.InvoiceResult == nil {
+		writeError(w, http.StatusBadGateway, "tapd returned an asset invoice without a quote")
+		return
+	}
+
+	payReq, err := h.lightningClient.DecodePayReq(ctx, &lnrpc.PayReqString{
+		PayReq: resp.InvoiceResult.PaymentRequest,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error decoding asset invoice: %s", err.Error())
+		return
+	}
+
+	invoice := assetInvoice{
+		PaymentRequest: resp.InvoiceResult.PaymentRequest,
+		PaymentHash:    hex.EncodeToString(resp.InvoiceResult.RHash),
+		PaymentAddr:    hex.EncodeToString(resp.InvoiceResult.PaymentAddr),
+		AddIndex:       resp.InvoiceResult.AddIndex,
+		AssetID:        listing.AssetID,
+		AssetAmount:    req.AssetAmount,
+		ValueSat:       payReq.NumSatoshis,
+		Quote:          newBuyQuote(resp.AcceptedBuyQuote),
+	}
+
+	purchase, err := h.store.CreatePurchase(ctx, store.Purchase{
+		ListingID:       listing.ID,
+		BuyerPubkey:     authedPubkey(r),
+		SellerPubkey:    listing.NodePubkey,
+		AssetID:         listing.AssetID,
+		AssetAmount:     req.AssetAmount,
+		InvoiceSats:     uint64(payReq.NumSatoshis),
+		RateCoefficient: invoice.Quote.Rate.Coefficient,
+		RateScale:       invoice.Quote.Rate.Scale,
+		QuoteID:         invoice.Quote.ID,
+		PaymentHash:     invoice.PaymentHash,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	invoice.PurchaseID = purchase.ID
+	h.invoices.watch(ctx, *purchase)
+
+	writeJSON(w, http.StatusOK, struct {
+		Invoice assetInvoice `json:"invoice"`
+	}{
+		Invoice: invoice,
+	})
+}
+
+// parsePaymentHash decodes a hex payment hash.
+func parsePaymentHash(s string) ([]byte, error) {
+	hash, err := hex.DecodeString(s)
+	if err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("invalid payment hash %q", s)
+	}
+	return hash, nil
+}
+
+// lookupInvoice looks up the invoice of one of the caller's purchases,
+// writing an error response if it can't. Invoices the caller neither paid nor
+// got paid through are reported as not found, whatever else is on our lnd.
+func (h *Handler) lookupInvoice(w http.ResponseWriter, r *http.Request) (*lnrpc.Invoice, bool) {
+	paymentHash := r.URL.Query().Get("paymentHash")
+	hash, err := parsePaymentHash(paymentHash)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return nil, false
+	}
+
+	ctx := r.Context()
+	purchase, err := h.store.GetPurchaseByPaymentHash(ctx, hex.EncodeToString(hash))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "invoice %s not found", paymentHash)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return nil, false
+	}
+	if caller := authedPubkey(r); caller != purchase.BuyerPubkey && caller != purchase.SellerPubkey {
+		writeError(w, http.StatusNotFound, "invoice %s not found", paymentHash)
+		return nil, false
+	}
+
+	invoice, err := h.lightningClient.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: hash})
+	if s, ok := grpcStatus(err); ok && s.Code() == codes.NotFound {
+		writeError(w, http.StatusNotFound, "invoice %s not found", paymentHash)
+		return nil, false
+	}
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error looking up invoice: %s", err.Error())
+		return nil, false
+	}
+
+	return invoice, true
+}
+
+// GetInvoice reports the state of an invoice, what was paid for it and, for
+// asset invoices, how many asset units that settled.
+func (h *Handler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := h.lookupInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Invoice invoiceUpdate `json:"invoice"`
+	}{
+		Invoice: newInvoiceUpdate(invoice),
+	})
+}
+
+// StreamInvoice is a server-sent event stream of an invoice's state. It
+// starts with the invoice's current state and ends once the invoice is
+// settled or canceled. Every stream holds an lnd subscription, so only so
+// many are let open at once, per node and in total.
+func (h *Handler) StreamInvoice(w http.ResponseWriter, r *http.Request) {
+	invoice, ok := h.lookupInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	release, err := h.invoiceStreams.acquire(authedPubkey(r))
+	switch {
+	case errors.Is(err, errTooManyStreams):
+		writeError(w, http.StatusTooManyRequests, "%s", err.Error())
+		return
+	case err != nil:
+		w.Header().Set("Retry-After", "1")
+		writeErrorDetails(w, http.StatusServiceUnavailable, map[string]any{
+			"retryAfter": 1,
+		}, "%s", err.Error())
+		return
+	}
+	defer release()
+
+	ctx := r.Context()
+	sub, err := h.invoicesClient.SubscribeSingleInvoice(ctx, &invoicesrpc.SubscribeSingleInvoiceRequest{
+		RHash: invoice.RHash,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error subscribing to invoice: %s", err.Error())
+		return
+	}
+
+	updates := make(chan *lnrpc.Invoice)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			invoice, err := sub.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case updates <- invoice:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	flusher, ok := startStream(w)
+	if !ok {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	// The subscription starts with the invoice's current state too, so
+	// that's left to it.
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case err := <-errs:
+			if ctx.Err() == nil {
+				fmt.Printf("invoice subscription failed: %s\n", err.Error())
+			}
+			return
+
+		case invoice := <-updates:
+			writeStreamEvent(w, flusher, streamInvoice, newInvoiceUpdate(invoice))
+			if invoice.State == lnrpc.Invoice_SETTLED || invoice.State == lnrpc.Invoice_CANCELED {
+				return
+			}
+		}
+	}
+}
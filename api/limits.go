@@ -0,0 +1,356 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit is a token bucket: PerSecond tokens are added each second, up to
+// Burst. A zero PerSecond turns the limit off.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Limits keeps single clients from tying up lnd and tapd.
+type Limits struct {
+	// IP limits every request by client IP.
+	IP RateLimit
+
+	// VerifyIP and VerifyPubkey limit requests to the routes that verify
+	// signatures, proofs and holdings, by client IP and by session pubkey.
+	// VerifyIP also limits /comparePrices, which queries every listing
+	// node's price oracle.
+	VerifyIP     RateLimit
+	VerifyPubkey RateLimit
+
+	// MaxBodyBytes caps request bodies, MaxProofBodyBytes those of the
+	// routes that take proof files.
+	MaxBodyBytes      int64
+	MaxProofBodyBytes int64
+
+	// TapdConcurrency caps the requests calling tapd at once, zero for no
+	// cap.
+	TapdConcurrency int
+
+	// InvoiceStreams caps the /streamInvoice streams open at once, each
+	// holding an lnd subscription, and InvoiceStreamsPerNode those of one
+	// session pubkey. Zero for no cap.
+	InvoiceStreams        int
+	InvoiceStreamsPerNode int
+
+	// TrustForwardedFor takes the client IP from the X-Forwarded-For header
+	// set by the proxy in front of TapHub instead of the connection.
+	TrustForwardedFor bool
+}
+
+// DefaultLimits returns the limits TapHub runs with unless told otherwise.
+func DefaultLimits() Limits {
+	return Limits{
+		IP:                    RateLimit{PerSecond: 10, Burst: 40},
+		VerifyIP:              RateLimit{PerSecond: 0.5, Burst: 10},
+		VerifyPubkey:          RateLimit{PerSecond: 0.2, Burst: 5},
+		MaxBodyBytes:          64 << 10,
+		MaxProofBodyBytes:     3 << 20,
+		TapdConcurrency:       8,
+		InvoiceStreams:        64,
+		InvoiceStreamsPerNode: 4,
+	}
+}
+
+// tapdWait is how long a request waits for one of the tapd slots before
+// it's turned away.
+const tapdWait = 2 * time.Second
+
+// takesProof are the routes whose bodies carry proof files, and so get
+// Limits.MaxProofBodyBytes.
+var takesProof = map[string]bool{
+	"/verifyProof":    true,
+	"/verifyHoldings": true,
+}
+
+// keyedLimiter keeps a token bucket per key, e.g. per client IP.
+type keyedLimiter struct {
+	limit RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newKeyedLimiter returns nil, which lets everything through, if limit is
+// off.
+func newKeyedLimiter(limit RateLimit) *keyedLimiter {
+	if limit.PerSecond <= 0 {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return &keyedLimiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// reserve takes a token from key's bucket. If there is none it returns how
+// long until there will be.
+func (l *keyedLimiter) reserve(key string) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.limit.PerSecond), l.limit.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	res := b.limiter.ReserveN(now, 1)
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// prune drops the buckets that have been idle long enough to have filled
+// up again, which are no different from new ones. Must be called with mu
+// held.
+func (l *keyedLimiter) prune(now time.Time) {
+	refill := time.Duration(float64(l.limit.Burst) / l.limit.PerSecond * float64(time.Second))
+	every := max(refill, time.Minute)
+	if now.Sub(l.lastPrune) < every {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitBy returns middleware that turns requests away with 429 once the
+// bucket of their key runs dry.
+func limitBy(l *keyedLimiter, key func(*http.Request) string, what string) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if l == nil {
+			return next
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			wait, ok := l.reserve(key(r))
+			if !ok {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeErrorDetails(w, http.StatusTooManyRequests, map[string]any{
+					"retryAfter": retryAfter,
+				}, "too many requests from this %s, try again in %ds", what, retryAfter)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// clientIP returns the IP a request came from.
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.limits.TrustForwardedFor {
+		// Our proxy appends the address it saw, anything before it is
+		// up to the client.
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitIP rate limits every request by client IP.
+func (h *Handler) limitIP(next http.HandlerFunc) http.HandlerFunc {
+	return limitBy(h.ipLimiter, h.clientIP, "address")(next)
+}
+
+// limitVerifyIP rate limits verification and price comparison requests by
+// client IP.
+func (h *Handler) limitVerifyIP(next http.HandlerFunc) http.HandlerFunc {
+	return limitBy(h.verifyIPLimiter, h.clientIP, "address")(next)
+}
+
+// limitVerifyPubkey rate limits verification requests by session pubkey. It
+// has to come after Handler.Auth.
+func (h *Handler) limitVerifyPubkey(next http.HandlerFunc) http.HandlerFunc {
+	return limitBy(h.verifyPubkeyLimiter, authedPubkey, "node")(next)
+}
+
+// maxBody returns middleware that rejects request bodies over n bytes with
+// 413. Bodies that don't declare their length are cut off at n, and fail to
+// decode.
+func maxBody(n int64) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if n <= 0 {
+			return next
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				writeBodyTooLarge(w, n)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next(w, r)
+		}
+	}
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, n int64) {
+	writeErrorDetails(w, http.StatusRequestEntityTooLarge, map[string]any{
+		"maxBytes": n,
+	}, "request body is larger than %d bytes", n)
+}
+
+// tapdSlot holds one of the tapd slots while next runs, waiting up to
+// tapdWait for one to free up before answering 503.
+func (h *Handler) tapdSlot(next http.HandlerFunc) http.HandlerFunc {
+	if h.tapdSlots == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, ok := h.acquireTapdSlot(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+
+		next(w, r)
+	}
+}
+
+// acquireTapdSlot takes one of the tapd slots for handlers that only need
+// it for part of their work. If none frees up within tapdWait it writes a
+// 503 and reports false. Otherwise the slot is held until release is called.
+func (h *Handler) acquireTapdSlot(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	if h.tapdSlots == nil {
+		return func() {}, true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), tapdWait)
+	defer cancel()
+
+	select {
+	case h.tapdSlots <- struct{}{}:
+	case <-ctx.Done():
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return nil, false
+		}
+		w.Header().Set("Retry-After", "1")
+		writeErrorDetails(w, http.StatusServiceUnavailable, map[string]any{
+			"retryAfter": 1,
+		}, "tapd is busy, try again shortly")
+		return nil, false
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { <-h.tapdSlots }) }, true
+}
+
+// errTooManyStreams and errStreamsBusy are why streamSlots turned a stream
+// away: its node has too many open, or everyone together does.
+var (
+	errTooManyStreams = errors.New("too many open streams for this node, close one first")
+	errStreamsBusy    = errors.New("too many open streams, try again shortly")
+)
+
+// streamSlots caps long-lived streams, in total like tapdSlots does for
+// tapd calls and per session pubkey. Streams don't wait for a slot, they
+// are turned away at once.
+type streamSlots struct {
+	// total holds a token per open stream, nil for no cap.
+	total   chan struct{}
+	perNode int
+
+	mu     sync.Mutex
+	byNode map[string]int
+}
+
+func newStreamSlots(total, perNode int) *streamSlots {
+	s := &streamSlots{
+		perNode: perNode,
+		byNode:  make(map[string]int),
+	}
+	if total > 0 {
+		s.total = make(chan struct{}, total)
+	}
+
+	return s
+}
+
+// acquire takes a slot for a stream of pubkey, returning the func that
+// gives it back.
+func (s *streamSlots) acquire(pubkey string) (func(), error) {
+	if s.total != nil {
+		select {
+		case s.total <- struct{}{}:
+		default:
+			return nil, errStreamsBusy
+		}
+	}
+
+	s.mu.Lock()
+	if s.perNode > 0 && s.byNode[pubkey] >= s.perNode {
+		s.mu.Unlock()
+		if s.total != nil {
+			<-s.total
+		}
+		return nil, errTooManyStreams
+	}
+	s.byNode[pubkey]++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			if s.byNode[pubkey]--; s.byNode[pubkey] == 0 {
+				delete(s.byNode, pubkey)
+			}
+			s.mu.Unlock()
+			if s.total != nil {
+				<-s.total
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiterReserve(t *testing.T) {
+	if newKeyedLimiter(RateLimit{}) != nil {
+		t.Fatal("limiter without a rate isn't off")
+	}
+	var off *keyedLimiter
+	if _, ok := off.reserve("a"); !ok {
+		t.Fatal("limit that's off turned a request away")
+	}
+
+	l := newKeyedLimiter(RateLimit{PerSecond: 1, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if _, ok := l.reserve("a"); !ok {
+			t.Fatalf("request %d within the burst was turned away", i+1)
+		}
+	}
+	wait, ok := l.reserve("a")
+	if ok {
+		t.Fatal("request over the burst was let through")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("wait %s, want up to 1s", wait)
+	}
+
+	// Turned away requests don't use up tokens.
+	if wait2, _ := l.reserve("a"); wait2 > wait {
+		t.Fatalf("wait grew from %s to %s", wait, wait2)
+	}
+
+	// Every key has its own bucket.
+	if _, ok := l.reserve("b"); !ok {
+		t.Fatal("other key was turned away")
+	}
+}
+
+func TestKeyedLimiterPrune(t *testing.T) {
+	// A bucket refills in a second.
+	l := newKeyedLimiter(RateLimit{PerSecond: 10, Burst: 10})
+
+	now := time.Now()
+	l.reserve("idle")
+	l.reserve("active")
+	l.buckets["idle"].lastSeen = now.Add(-2 * time.Second)
+	l.lastPrune = time.Time{}
+
+	l.prune(now)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket was kept")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket was dropped")
+	}
+
+	// Pruning only runs once a minute.
+	l.buckets["active"].lastSeen = now.Add(-2 * time.Second)
+	l.prune(now.Add(time.Second))
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("pruned again within a minute")
+	}
+	l.prune(now.Add(time.Minute))
+	if _, ok := l.buckets["active"]; ok {
+		t.Error("idle bucket was kept a minute later")
+	}
+}
+
+func TestLimitByRetryAfter(t *testing.T) {
+	tests := []struct {
+		limit          RateLimit
+		wantRetryAfter int
+	}{
+		{RateLimit{PerSecond: 10, Burst: 1}, 1},
+		{RateLimit{PerSecond: 0.5, Burst: 1}, 2},
+		{RateLimit{PerSecond: 0.2, Burst: 1}, 5},
+	}
+	for _, test := range tests {
+		t.Run(strconv.Itoa(test.wantRetryAfter), func(t *testing.T) {
+			limit := limitBy(newKeyedLimiter(test.limit), func(*http.Request) string {
+				return "key"
+			}, "address")
+			handler := limit(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/v1/livez", nil))
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("first request got status %d, want %d", w.Code, http.StatusNoContent)
+			}
+
+			w = httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/v1/livez", nil))
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("second request got status %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+			if got, want := w.Header().Get("Retry-After"), strconv.Itoa(test.wantRetryAfter); got != want {
+				t.Errorf("Retry-After %q, want %q", got, want)
+			}
+			apiErr := decodeError(t, w)
+			if apiErr.Code != codeRateLimited {
+				t.Errorf("error code %q, want %q", apiErr.Code, codeRateLimited)
+			}
+			if got := apiErr.Details["retryAfter"]; got != float64(test.wantRetryAfter) {
+				t.Errorf("retryAfter %v, want %d", got, test.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestMaxBody(t *testing.T) {
+	const limit = 10
+
+	var readErr error
+	handler := maxBody(limit)(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// A body that fits is read whole.
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/v1/listing", strings.NewReader("0123456789")))
+	if w.Code != http.StatusNoContent || readErr != nil {
+		t.Fatalf("body within the limit got status %d and error %v", w.Code, readErr)
+	}
+
+	// A declared length over the limit is turned away up front.
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/v1/listing", strings.NewReader("0123456789a")))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	apiErr := decodeError(t, w)
+	if apiErr.Code != codeRequestTooLarge {
+		t.Errorf("error code %q, want %q", apiErr.Code, codeRequestTooLarge)
+	}
+	if got := apiErr.Details["maxBytes"]; got != float64(limit) {
+		t.Errorf("maxBytes %v, want %d", got, limit)
+	}
+
+	// Bodies without a declared length are cut off.
+	r := httptest.NewRequest(http.MethodPost, "/v1/listing", io.NopCloser(strings.NewReader("0123456789a")))
+	r.ContentLength = -1
+	handler(httptest.NewRecorder(), r)
+	var maxErr *http.MaxBytesError
+	if !errors.As(readErr, &maxErr) {
+		t.Fatalf("reading an unsized body over the limit got error %v, want %T", readErr, maxErr)
+	}
+}
+
+func TestStreamSlots(t *testing.T) {
+	s := newStreamSlots(2, 1)
+
+	release, err := s.acquire("a")
+	if err != nil {
+		t.Fatalf("error taking first slot: %s", err)
+	}
+	if _, err := s.acquire("a"); !errors.Is(err, errTooManyStreams) {
+		t.Fatalf("second stream of a node got error %v, want %v", err, errTooManyStreams)
+	}
+	if _, err := s.acquire("b"); err != nil {
+		t.Fatalf("error taking slot of another node: %s", err)
+	}
+	if _, err := s.acquire("c"); !errors.Is(err, errStreamsBusy) {
+		t.Fatalf("stream over the total got error %v, want %v", err, errStreamsBusy)
+	}
+
+	// Releasing twice only gives back one slot.
+	release()
+	release()
+	if _, err := s.acquire("a"); err != nil {
+		t.Fatalf("error taking a released slot: %s", err)
+	}
+	if _, err := s.acquire("c"); !errors.Is(err, errStreamsBusy) {
+		t.Fatalf("got error %v, want %v", err, errStreamsBusy)
+	}
+}
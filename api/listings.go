@@ -0,0 +1,248 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"TapHub/store"
+)
+
+type listingTerms struct {
+	SatsPerUnit    uint64 `json:"satsPerUnit"`
+	MinAmount      uint64 `json:"minAmount"`
+	MaxAmount      uint64 `json:"maxAmount"`
+	MinChannelSats uint64 `json:"minChannelSats"`
+	MaxChannelSats uint64 `json:"maxChannelSats"`
+}
+
+func (t listingTerms) validate() error {
+	if t.SatsPerUnit == 0 {
+		return fmt.Errorf("satsPerUnit must be greater than zero")
+	}
+	if t.MinAmount == 0 {
+		return fmt.Errorf("minAmount must be greater than zero")
+	}
+	if t.MaxAmount < t.MinAmount {
+		return fmt.Errorf("maxAmount must not be less than minAmount")
+	}
+	if t.MaxChannelSats != 0 && t.MaxChannelSats < t.MinChannelSats {
+		return fmt.Errorf("maxChannelSats must not be less than minChannelSats")
+	}
+
+	return nil
+}
+
+func (h *Handler) CreateListing(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AssetID string `json:"assetId"`
+		listingTerms
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding create listing request: %s", err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	pubkey := authedPubkey(r)
+	registered, err := h.store.IsRegistered(ctx, pubkey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	if !registered {
+		writeError(w, http.StatusForbidden, "node %s must be registered before listing assets", pubkey)
+		return
+	}
+
+	// Only assets our universe knows about can be listed.
+	asset, err := h.lookupAsset(ctx, req.AssetID)
+	if errors.Is(err, errAssetNotFound) {
+		writeError(w, http.StatusBadRequest, "asset %s not found", req.AssetID)
+		return
+	}
+	if errors.Is(err, errInvalidAssetID) {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "%s", err.Error())
+		return
+	}
+
+	// Store the ID the way every lookup spells it, so a differently cased
+	// ID can't dodge the one listing per asset and node limit.
+	req.AssetID = hex.EncodeToString(asset.AssetId)
+
+	listing, err := h.store.CreateListing(ctx, store.Listing{
+		NodePubkey:     pubkey,
+		AssetID:        req.AssetID,
+		AssetName:      asset.AssetName,
+		SatsPerUnit:    req.SatsPerUnit,
+		MinAmount:      req.MinAmount,
+		MaxAmount:      req.MaxAmount,
+		MinChannelSats: req.MinChannelSats,
+		MaxChannelSats: req.MaxChannelSats,
+	})
+	if errors.Is(err, store.ErrAlreadyExists) {
+		writeError(w, http.StatusConflict, "node %s already has a listing for asset %s", pubkey, req.AssetID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Listing *store.Listing `json:"listing"`
+	}{
+		Listing: listing,
+	})
+}
+
+func (h *Handler) UpdateListing(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID int64 `json:"id"`
+		listingTerms
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding update listing request: %s", err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	listing, err := h.store.UpdateListing(r.Context(), store.Listing{
+		ID:             req.ID,
+		NodePubkey:     authedPubkey(r),
+		SatsPerUnit:    req.SatsPerUnit,
+		MinAmount:      req.MinAmount,
+		MaxAmount:      req.MaxAmount,
+		MinChannelSats: req.MinChannelSats,
+		MaxChannelSats: req.MaxChannelSats,
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "listing %d not found", req.ID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Listing *store.Listing `json:"listing"`
+	}{
+		Listing: listing,
+	})
+}
+
+func (h *Handler) DeleteListing(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding delete listing request: %s", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	err = h.store.DeleteListing(ctx, req.ID, authedPubkey(r))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "listing %d not found", req.ID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	h.holdings.unwatch(ctx, req.ID)
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{
+		Success: true,
+	})
+}
+
+func (h *Handler) ListListings(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if id := q.Get("id"); id != "" {
+		listingID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid listing id %q", id)
+			return
+		}
+		listing, err := h.store.GetListing(r.Context(), listingID)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "listing %d not found", listingID)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err.Error())
+			return
+		}
+
+		h.writeListings(w, r, []store.Listing{*listing})
+		return
+	}
+
+	listings, err := h.store.ListListings(r.Context(), store.ListingFilter{
+		NodePubkey: q.Get("nodePubkey"),
+		AssetID:    strings.ToLower(q.Get("assetId")),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	h.writeListings(w, r, listings)
+}
+
+// listingView is a listing along with the reputation of its node.
+type listingView struct {
+	store.Listing
+	Reputation *reputation `json:"reputation"`
+}
+
+func (h *Handler) writeListings(w http.ResponseWriter, r *http.Request, listings []store.Listing) {
+	pubkeys := make([]string, 0, len(listings))
+	for _, l := range listings {
+		pubkeys = append(pubkeys, l.NodePubkey)
+	}
+	reps, err := h.reputations(r.Context(), pubkeys...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	views := make([]listingView, 0, len(listings))
+	for _, l := range listings {
+		views = append(views, listingView{
+			Listing:    l,
+			Reputation: reps[l.NodePubkey],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Listings []listingView `json:"listings"`
+	}{
+		Listings: views,
+	})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"TapHub/publicnet"
+	"TapHub/store"
+)
+
+// RegisterNode adds the caller's node to the registry. The pubkey is never
+// taken from the request, only from the session, which can only be obtained
+// by signing a challenge that /verifyMessage accepted. Nodes may share the
+// address of their price oracle for /comparePrices to query, as long as it
+// is on the public internet.
+func (h *Handler) RegisterNode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Alias       string `json:"alias"`
+		Description string `json:"description"`
+		PriceOracle string `json:"priceOracle"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding register node request: %s", err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if req.PriceOracle != "" {
+		host, _, err := net.SplitHostPort(req.PriceOracle)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid priceOracle %q, expected host:port", req.PriceOracle)
+			return
+		}
+		if err := publicnet.CheckHost(ctx, host); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid priceOracle %q: %s", req.PriceOracle, err.Error())
+			return
+		}
+	}
+
+	pubkey := authedPubkey(r)
+	if req.Alias == "" {
+		req.Alias = h.nodeAlias(pubkey)
+	}
+
+	node, err := h.store.RegisterNode(ctx, store.Node{
+		Pubkey:      pubkey,
+		Alias:       req.Alias,
+		Description: req.Description,
+		PriceOracle: req.PriceOracle,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	h.nodeOracles.remove(pubkey)
+	h.monitor.NodesChanged()
+
+	writeJSON(w, http.StatusOK, struct {
+		Node *store.Node `json:"node"`
+	}{
+		Node: node,
+	})
+}
+
+func (h *Handler) GetNode(w http.ResponseWriter, r *http.Request) {
+	pubkey := r.URL.Query().Get("pubkey")
+	if pubkey == "" {
+		writeError(w, http.StatusBadRequest, "pubkey is required")
+		return
+	}
+
+	node, err := h.store.GetNode(r.Context(), pubkey)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "node %s is not registered", pubkey)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Node *store.Node `json:"node"`
+	}{
+		Node: node,
+	})
+}
+
+func (h *Handler) ListNodes(w http.ResponseWriter, r *http.Request) {
+	nodes, err := h.store.ListNodes(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Nodes []store.Node `json:"nodes"`
+	}{
+		Nodes: nodes,
+	})
+}
+
+// DeregisterNode removes the caller's own node from the registry.
+func (h *Handler) DeregisterNode(w http.ResponseWriter, r *http.Request) {
+	pubkey := authedPubkey(r)
+	err := h.store.DeregisterNode(r.Context(), pubkey)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "node %s is not registered", pubkey)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	h.nodeOracles.remove(pubkey)
+	h.monitor.NodesChanged()
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{
+		Success: true,
+	})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// SpecPath is where, under APIPrefix, the OpenAPI document describing the
+// API is served.
+const SpecPath = "/openapi.json"
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+var validationOptions = &openapi3filter.Options{
+	// Sessions are checked by Handler.Auth, the spec only documents them.
+	AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+}
+
+func init() {
+	// Keep schema dumps out of the error messages we hand to clients.
+	openapi3.SchemaErrorDetailsDisabled = true
+}
+
+// loadSpec parses and validates the embedded OpenAPI document, returning it
+// along with its JSON encoding for serving.
+func loadSpec() (*openapi3.T, []byte, error) {
+	loader := openapi3.NewLoader()
+	spec, err := loader.LoadFromData(openAPIYAML)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading openapi spec: %w", err)
+	}
+	if err := spec.Validate(loader.Context); err != nil {
+		return nil, nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding openapi spec: %w", err)
+	}
+
+	return spec, specJSON, nil
+}
+
+// Spec serves the OpenAPI document.
+func (h *Handler) Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(h.specJSON)
+}
+
+// validated returns middleware that rejects requests that don't match the
+// spec's description of the route before they reach the handler, and logs
+// responses that don't match it.
+func (h *Handler) validated(method, path string) (middleware, error) {
+	item := h.spec.Paths.Find(path)
+	if item == nil || item.GetOperation(method) == nil {
+		return nil, fmt.Errorf("openapi spec doesn't describe %s %s", method, path)
+	}
+	route := &routers.Route{
+		Spec:      h.spec,
+		Path:      path,
+		PathItem:  item,
+		Method:    method,
+		Operation: item.GetOperation(method),
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// JSON is the only body the API takes, so requests that
+			// don't say what they send are read as JSON. That's only
+			// assumed for validation, on a copy, the request the
+			// handler gets keeps its own headers.
+			vr := r.Clone(r.Context())
+			if vr.Header.Get("Content-Type") == "" {
+				vr.Header.Set("Content-Type", "application/json")
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request: vr,
+				Route:   route,
+				Options: validationOptions,
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			// Validation read the body and left a fresh reader for it
+			// on the copy.
+			r.Body, r.GetBody, r.ContentLength = vr.Body, vr.GetBody, vr.ContentLength
+
+			rec := &responseRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+			next(rec, r)
+			if !rec.recording {
+				return
+			}
+
+			err := openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 rec.status,
+				Header:                 rec.Header(),
+				Body:                   io.NopCloser(&rec.body),
+				Options:                validationOptions,
+			})
+			if err != nil {
+				log.Printf("openapi: %s %s response doesn't match the spec: %s\n", method, path, err)
+			}
+		}
+	}, nil
+}
+
+// writeValidationError turns a request validation failure into an
+// invalid_request error naming the parameter or field at fault.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeBodyTooLarge(w, tooLarge.Limit)
+		return
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	details := map[string]any{}
+	reason := reqErr.Reason
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		// allOf and the like report on the whole value, the error that
+		// caused theirs is the one that names the field.
+		pointer := schemaErr.JSONPointer()
+		for {
+			var cause *openapi3.SchemaError
+			if !errors.As(schemaErr.Origin, &cause) {
+				break
+			}
+			schemaErr = cause
+			if p := schemaErr.JSONPointer(); len(p) > 0 {
+				pointer = p
+			}
+		}
+		reason = schemaErr.Reason
+		if len(pointer) > 0 {
+			details["field"] = strings.Join(pointer, ".")
+		}
+	} else if reqErr.Err != nil {
+		reason = reqErr.Err.Error()
+	}
+
+	switch {
+	case reqErr.Parameter != nil:
+		details["parameter"] = reqErr.Parameter.Name
+		writeErrorDetails(w, http.StatusBadRequest, details, "invalid %s parameter %s: %s", reqErr.Parameter.In, reqErr.Parameter.Name, reason)
+
+	case reqErr.RequestBody != nil:
+		writeErrorDetails(w, http.StatusBadRequest, details, "invalid request body: %s", reason)
+
+	default:
+		writeErrorDetails(w, http.StatusBadRequest, details, "%s", reqErr.Error())
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of JSON
+// bodies, so they can be checked against the spec once written.
+type responseRecorder struct {
+	statusRecorder
+	recording bool
+	body      bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		mediaType, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		rec.recording = mediaType == "application/json"
+	}
+	rec.statusRecorder.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.recording {
+		rec.body.Write(b)
+	}
+	return rec.statusRecorder.Write(b)
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"TapHub/publicnet"
+
+	"github.com/lightninglabs/taproot-assets/asset"
+	"github.com/lightninglabs/taproot-assets/fn"
+	"github.com/lightninglabs/taproot-assets/rfq"
+	"github.com/lightninglabs/taproot-assets/rfqmsg"
+	"github.com/lightninglabs/taproot-assets/rpcutils"
+	oraclerpc "github.com/lightninglabs/taproot-assets/taprpc/priceoraclerpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// nodeOracle is a client for a registered node's price oracle. It speaks the
+// same protocol as tapd's rfq.RpcPriceOracle, which can neither be closed nor
+// be kept from dialing TapHub's own network, so it can't be pointed at
+// addresses nodes hand us.
+type nodeOracle struct {
+	addr   string
+	conn   *grpc.ClientConn
+	client oraclerpc.PriceOracleClient
+}
+
+var _ rfq.PriceOracle = (*nodeOracle)(nil)
+
+// dialNodeOracle sets up a client for the oracle at addr, a host:port. Like
+// tapd, the oracle's TLS certificate isn't verified. Connections to anything
+// but public addresses are refused.
+func dialNodeOracle(addr string) (*nodeOracle, error) {
+	dialer := &net.Dialer{Control: publicnet.Control}
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: true,
+		})),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodeOracle{
+		addr:   addr,
+		conn:   conn,
+		client: oraclerpc.NewPriceOracleClient(conn),
+	}, nil
+}
+
+func (o *nodeOracle) Close() error {
+	return o.conn.Close()
+}
+
+// QueryAskPrice asks the oracle what it would sell the asset for.
+func (o *nodeOracle) QueryAskPrice(ctx context.Context, specifier asset.Specifier,
+	assetMaxAmt fn.Option[uint64], paymentMaxAmt fn.Option[lnwire.MilliSatoshi],
+	hint fn.Option[rfqmsg.AssetRate]) (*rfq.OracleResponse, error) {
+
+	return o.query(ctx, oraclerpc.TransactionType_SALE, specifier, assetMaxAmt, paymentMaxAmt, hint)
+}
+
+// QueryBidPrice asks the oracle what it would buy the asset for.
+func (o *nodeOracle) QueryBidPrice(ctx context.Context, specifier asset.Specifier,
+	assetMaxAmt fn.Option[uint64], paymentMaxAmt fn.Option[lnwire.MilliSatoshi],
+	hint fn.Option[rfqmsg.AssetRate]) (*rfq.OracleResponse, error) {
+
+	return o.query(ctx, oraclerpc.TransactionType_PURCHASE, specifier, assetMaxAmt, paymentMaxAmt, hint)
+}
+
+func (o *nodeOracle) query(ctx context.Context, txType oraclerpc.TransactionType,
+	specifier asset.Specifier, assetMaxAmt fn.Option[uint64],
+	paymentMaxAmt fn.Option[lnwire.MilliSatoshi],
+	hint fn.Option[rfqmsg.AssetRate]) (*rfq.OracleResponse, error) {
+
+	rpcHint, err := fn.MapOptionZ(hint, rpcutils.MarshalAssetRates).Unpack()
+	if err != nil {
+		return nil, err
+	}
+
+	var subject oraclerpc.AssetSpecifier
+	switch {
+	case specifier.HasId():
+		id := specifier.UnwrapIdToPtr()
+		subject.Id = &oraclerpc.AssetSpecifier_AssetId{AssetId: id[:]}
+	case specifier.HasGroupPubKey():
+		groupKey := specifier.UnwrapGroupKeyToPtr()
+		subject.Id = &oraclerpc.AssetSpecifier_GroupKey{GroupKey: groupKey.SerializeCompressed()}
+	}
+
+	// The payment asset is BTC, an all zero asset ID.
+	resp, err := o.client.QueryAssetRates(ctx, &oraclerpc.QueryAssetRatesRequest{
+		TransactionType:       txType,
+		SubjectAsset:          &subject,
+		SubjectAssetMaxAmount: assetMaxAmt.UnwrapOr(0),
+		PaymentAsset: &oraclerpc.AssetSpecifier{
+			Id: &oraclerpc.AssetSpecifier_AssetId{AssetId: make([]byte, 32)},
+		},
+		PaymentAssetMaxAmount: uint64(paymentMaxAmt.UnwrapOr(0)),
+		AssetRatesHint:        rpcHint,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch result := resp.GetResult().(type) {
+	case *oraclerpc.QueryAssetRatesResponse_Ok:
+		rates := result.Ok.GetAssetRates()
+		if rates == nil {
+			return nil, errors.New("oracle returned no asset rates")
+		}
+		rate, err := rpcutils.UnmarshalFixedPoint(rates.SubjectAssetRate)
+		if err != nil {
+			return nil, err
+		}
+		if rates.ExpiryTimestamp > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid expiry timestamp %d", rates.ExpiryTimestamp)
+		}
+		expiry := time.Unix(int64(rates.ExpiryTimestamp), 0).UTC()
+
+		return &rfq.OracleResponse{AssetRate: rfqmsg.NewAssetRate(*rate, expiry)}, nil
+
+	case *oraclerpc.QueryAssetRatesResponse_Error:
+		return &rfq.OracleResponse{Err: &rfq.OracleError{Msg: result.Error.GetMessage()}}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected oracle response %T", result)
+	}
+}
+
+// priceOracles keeps a client for the price oracle of every node whose
+// oracle was queried, so repeated comparisons reuse the connections.
+type priceOracles struct {
+	mu      sync.Mutex
+	oracles map[string]*nodeOracle // by node pubkey
+}
+
+func newPriceOracles() *priceOracles {
+	return &priceOracles{
+		oracles: make(map[string]*nodeOracle),
+	}
+}
+
+// get returns the client for the node's oracle at addr, connecting on first
+// use. A client for an address the node since moved away from is closed.
+func (p *priceOracles) get(pubkey, addr string) (*nodeOracle, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if o, ok := p.oracles[pubkey]; ok {
+		if o.addr == addr {
+			return o, nil
+		}
+		o.Close()
+		delete(p.oracles, pubkey)
+	}
+
+	o, err := dialNodeOracle(addr)
+	if err != nil {
+		return nil, err
+	}
+	p.oracles[pubkey] = o
+
+	return o, nil
+}
+
+// remove closes the client for the node's oracle, if there is one. Queries
+// still running on it fail.
+func (p *priceOracles) remove(pubkey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if o, ok := p.oracles[pubkey]; ok {
+		o.Close()
+		delete(p.oracles, pubkey)
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightninglabs/taproot-assets/asset"
+	"github.com/lightninglabs/taproot-assets/fn"
+	"github.com/lightninglabs/taproot-assets/rfq"
+	"github.com/lightninglabs/taproot-assets/rfqmath"
+	"github.com/lightninglabs/taproot-assets/rfqmsg"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"google.golang.org/grpc/codes"
+)
+
+// oracleQueryTimeout is how long each node's price oracle gets to answer
+// both the bid and the ask query.
+const oracleQueryTimeout = 5 * time.Second
+
+// oraclePrice is a price oracle's rate for an asset, normalized to sats.
+type oraclePrice struct {
+	// Rate is the number of asset units per BTC as the oracle gave it.
+	Rate fixedPoint `json:"rate"`
+
+	SatsPerUnit float64 `json:"satsPerUnit"`
+
+	// TotalSats is what the compared amount comes to at the rate.
+	TotalSats int64 `json:"totalSats"`
+
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// oracleQuote is what one node's price oracle quoted for an asset. The ask
+// is what the node would sell units for, the bid what it would buy them
+// for.
+type oracleQuote struct {
+	NodePubkey  string `json:"nodePubkey,omitempty"`
+	Alias       string `json:"alias,omitempty"`
+	ListingID   int64  `json:"listingId,omitempty"`
+	PriceOracle string `json:"priceOracle,omitempty"`
+
+	// ListedSatsPerUnit is the listing's static price, to compare the
+	// live one to.
+	ListedSatsPerUnit uint64 `json:"listedSatsPerUnit,omitempty"`
+
+	Ask *oraclePrice `json:"ask,omitempty"`
+	Bid *oraclePrice `json:"bid,omitempty"`
+
+	// Rank orders the quotes by ask, cheapest first, starting at 1.
+	// Quotes that failed aren't ranked and say why in Error.
+	Rank      int    `json:"rank,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+func newOraclePrice(rate rfqmsg.AssetRate, amount uint64) (*oraclePrice, error) {
+	unitsPerBtc := rate.Rate.ToFloat64()
+	if unitsPerBtc <= 0 {
+		return nil, errors.New("oracle returned a zero rate")
+	}
+	msat := rfqmath.UnitsToMilliSatoshi(rfqmath.NewBigIntFixedPoint(amount, 0), rate.Rate)
+
+	return &oraclePrice{
+		Rate: fixedPoint{
+			Coefficient: rate.Rate.Coefficient.String(),
+			Scale:       uint32(rate.Rate.Scale),
+		},
+		SatsPerUnit: 1e8 / unitsPerBtc,
+		TotalSats:   int64(msat.ToSatoshis()),
+		ExpiresAt:   rate.Expiry,
+	}, nil
+}
+
+// queryOracle asks the oracle for its ask and bid for amount units of the
+// asset, filling them into q. Failures are recorded in q.Error.
+func queryOracle(ctx context.Context, o rfq.PriceOracle, assetID asset.ID, amount uint64, q *oracleQuote) {
+	ctx, cancel := context.WithTimeout(ctx, oracleQueryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		q.LatencyMs = time.Since(start).Milliseconds()
+	}()
+
+	specifier := asset.NewSpecifierFromId(assetID)
+	query := func(ask bool) (*oraclePrice, error) {
+		queryPrice := o.QueryBidPrice
+		if ask {
+			queryPrice = o.QueryAskPrice
+		}
+		resp, err := queryPrice(
+			ctx, specifier, fn.Some(amount),
+			fn.None[lnwire.MilliSatoshi](), fn.None[rfqmsg.AssetRate](),
+		)
+		if err != nil {
+			return nil, oracleFailure(ctx, err)
+		}
+		if resp.Err != nil {
+			return nil, fmt.Errorf("oracle refused to quote: %s", resp.Err.Msg)
+		}
+
+		return newOraclePrice(resp.AssetRate, amount)
+	}
+
+	ask, err := query(true)
+	if err != nil {
+		q.Error = fmt.Sprintf("ask: %s", err.Error())
+		return
+	}
+	bid, err := query(false)
+	if err != nil {
+		q.Error = fmt.Sprintf("bid: %s", err.Error())
+		return
+	}
+	q.Ask, q.Bid = ask, bid
+}
+
+// oracleFailure explains why a price oracle query failed.
+func oracleFailure(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", oracleQueryTimeout)
+	}
+	if s, ok := grpcStatus(err); ok {
+		switch s.Code() {
+		case codes.Unavailable:
+			return fmt.Errorf("oracle unreachable: %s", s.Message())
+		case codes.Unimplemented:
+			return errors.New("not a price oracle")
+		}
+		return fmt.Errorf("%s: %s", s.Code(), s.Message())
+	}
+
+	return err
+}
+
+// rankQuotes sorts quotes by ask, cheapest first, with failed quotes last,
+// and numbers the ones that succeeded.
+func rankQuotes(quotes []oracleQuote) {
+	sort.SliceStable(quotes, func(i, j int) bool {
+		a, b := quotes[i].Ask, quotes[j].Ask
+		switch {
+		case a == nil || b == nil:
+			return a != nil
+		case a.SatsPerUnit != b.SatsPerUnit:
+			return a.SatsPerUnit < b.SatsPerUnit
+		default:
+			return quotes[i].Bid.SatsPerUnit > quotes[j].Bid.SatsPerUnit
+		}
+	})
+	for i := range quotes {
+		if quotes[i].Ask != nil {
+			quotes[i].Rank = i + 1
+		}
+	}
+}
+
+// ComparePrices asks the price oracle of every registered node listing an
+// asset what it would sell and buy an amount of it for right now, and ranks
+// the nodes by the live price. Each oracle is queried with its own timeout,
+// nodes that couldn't be quoted say why. TapHub's own oracle, if it has one,
+// is queried too as a reference.
+func (h *Handler) ComparePrices(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	assetID := q.Get("assetId")
+	id, err := hex.DecodeString(assetID)
+	if err != nil || len(id) != 32 {
+		writeError(w, http.StatusBadRequest, "%s %q", errInvalidAssetID, assetID)
+		return
+	}
+	assetID = hex.EncodeToString(id)
+	amount, err := strconv.ParseUint(q.Get("amount"), 10, 64)
+	if err != nil || amount == 0 {
+		writeError(w, http.StatusBadRequest, "amount must be a positive number of asset units")
+		return
+	}
+
+	ctx := r.Context()
+	listings, err := h.store.ListListings(ctx, store.ListingFilter{AssetID: assetID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	var specID asset.ID
+	copy(specID[:], id)
+
+	quotes := make([]oracleQuote, len(listings))
+	oracles := make([]rfq.PriceOracle, len(listings))
+	for i, l := range listings {
+		quote := &quotes[i]
+		quote.NodePubkey = l.NodePubkey
+		quote.ListingID = l.ID
+		quote.ListedSatsPerUnit = l.SatsPerUnit
+
+		// The node can deregister while we go through its listings.
+		node, err := h.store.GetNode(ctx, l.NodePubkey)
+		if errors.Is(err, store.ErrNotFound) {
+			quote.Error = "node is no longer registered"
+			continue
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err.Error())
+			return
+		}
+		quote.Alias = node.Alias
+		quote.PriceOracle = node.PriceOracle
+		if node.PriceOracle == "" {
+			quote.Error = "node has no price oracle registered"
+			continue
+		}
+		oracle, err := h.nodeOracles.get(node.Pubkey, node.PriceOracle)
+		if err != nil {
+			quote.Error = fmt.Sprintf("invalid price oracle address: %s", err.Error())
+			continue
+		}
+		oracles[i] = oracle
+	}
+
+	var wg sync.WaitGroup
+	for i, oracle := range oracles {
+		if oracle == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queryOracle(ctx, oracle, specID, amount, &quotes[i])
+		}()
+	}
+
+	var reference *oracleQuote
+	if h.oracle != nil {
+		reference = &oracleQuote{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queryOracle(ctx, h.oracle, specID, amount, reference)
+		}()
+	}
+	wg.Wait()
+
+	rankQuotes(quotes)
+
+	writeJSON(w, http.StatusOK, struct {
+		AssetID   string        `json:"assetId"`
+		Amount    uint64        `json:"amount"`
+		Quotes    []oracleQuote `json:"quotes"`
+		Reference *oracleQuote  `json:"reference,omitempty"`
+	}{
+		AssetID:   assetID,
+		Amount:    amount,
+		Quotes:    quotes,
+		Reference: reference,
+	})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type nodeFeature struct {
+	Bit        uint32 `json:"bit"`
+	Name       string `json:"name"`
+	IsRequired bool   `json:"isRequired"`
+	IsKnown    bool   `json:"isKnown"`
+}
+
+type nodeAddress struct {
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+}
+
+// registrationSummary is what TapHub knows about a node beyond the graph.
+type registrationSummary struct {
+	Registered       bool      `json:"registered"`
+	RegisteredAt     time.Time `json:"registeredAt,omitzero"`
+	Description      string    `json:"description,omitempty"`
+	Listings         int       `json:"listings"`
+	HoldingsVerified int       `json:"holdingsVerified"`
+	ListedAssetIDs   []string  `json:"listedAssetIds"`
+
+	// Reputation is only set for registered nodes.
+	Reputation *reputation `json:"reputation,omitempty"`
+}
+
+// GetNodeProfile returns a node's public profile: what it announces to the
+// network, its channels, and its standing on TapHub.
+func (h *Handler) GetNodeProfile(w http.ResponseWriter, r *http.Request) {
+	pubkey := r.URL.Query().Get("pubkey")
+	if pubkey == "" {
+		writeError(w, http.StatusBadRequest, "pubkey is required")
+		return
+	}
+
+	ctx := r.Context()
+	b := h.backend(r)
+	info, err := b.Lightning.GetNodeInfo(ctx, &lnrpc.NodeInfoRequest{
+		PubKey:          pubkey,
+		IncludeChannels: true,
+	})
+	if status.Code(err) == codes.NotFound {
+		writeError(w, http.StatusNotFound, "node %s not found in the graph", pubkey)
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "error getting node info: %s", err.Error())
+		return
+	}
+
+	features := make([]nodeFeature, 0, len(info.Node.Features))
+	for bit, f := range info.Node.Features {
+		features = append(features, nodeFeature{
+			Bit:        bit,
+			Name:       f.Name,
+			IsRequired: f.IsRequired,
+			IsKnown:    f.IsKnown,
+		})
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].Bit < features[j].Bit
+	})
+
+	addresses := make([]nodeAddress, 0, len(info.Node.Addresses))
+	for _, a := range info.Node.Addresses {
+		addresses = append(addresses, nodeAddress{
+			Network: a.Network,
+			Addr:    a.Addr,
+		})
+	}
+
+	// Asset channels can only be recognized among the backend's own
+	// channels, the rest are counted as unknown.
+	details, err := h.describeChannels(ctx, b, info.Channels)
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "%s", err.Error())
+		return
+	}
+	assetChannels, unknownChannels := 0, 0
+	for _, d := range details {
+		switch {
+		case d.IsAssetChannel == nil:
+			unknownChannels++
+		case *d.IsAssetChannel:
+			assetChannels++
+		}
+	}
+
+	summary := registrationSummary{ListedAssetIDs: []string{}}
+	node, err := h.store.GetNode(ctx, pubkey)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		// Not registered, the graph is all there is.
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	default:
+		summary.Registered = true
+		summary.RegisteredAt = node.RegisteredAt
+		summary.Description = node.Description
+
+		listings, err := h.store.ListListings(ctx, store.ListingFilter{NodePubkey: pubkey})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err.Error())
+			return
+		}
+		summary.Listings = len(listings)
+		for _, l := range listings {
+			summary.ListedAssetIDs = append(summary.ListedAssetIDs, l.AssetID)
+			if l.HoldingsVerified {
+				summary.HoldingsVerified++
+			}
+		}
+
+		reps, err := h.reputations(ctx, pubkey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err.Error())
+			return
+		}
+		summary.Reputation = reps[pubkey]
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Pubkey               string              `json:"pubkey"`
+		Alias                string              `json:"alias"`
+		Color                string              `json:"color"`
+		LastUpdate           time.Time           `json:"lastUpdate"`
+		Features             []nodeFeature       `json:"features"`
+		Addresses            []nodeAddress       `json:"addresses"`
+		TotalCapacity        int64               `json:"totalCapacity"`
+		NumChannels          uint32              `json:"numChannels"`
+		AssetChannels        int                 `json:"assetChannels"`
+		UnknownAssetChannels int                 `json:"unknownAssetChannels"`
+		Registration         registrationSummary `json:"registration"`
+	}{
+		Pubkey:               info.Node.PubKey,
+		Alias:                info.Node.Alias,
+		Color:                info.Node.Color,
+		LastUpdate:           time.Unix(int64(info.Node.LastUpdate), 0),
+		Features:             features,
+		Addresses:            addresses,
+		TotalCapacity:        info.TotalCapacity,
+		NumChannels:          info.NumChannels,
+		AssetChannels:        assetChannels,
+		UnknownAssetChannels: unknownChannels,
+		Registration:         summary,
+	})
+}
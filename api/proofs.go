@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"TapHub/webhook"
+
+	"github.com/lightninglabs/taproot-assets/taprpc"
+)
+
+// provenAsset is what a valid proof file shows about the asset it ends in.
+type provenAsset struct {
+	AssetID        string `json:"assetId"`
+	AssetName      string `json:"assetName"`
+	GroupKey       string `json:"groupKey,omitempty"`
+	GenesisPoint   string `json:"genesisPoint"`
+	Amount         uint64 `json:"amount"`
+	ScriptKey      string `json:"scriptKey"`
+	AnchorOutpoint string `json:"anchorOutpoint"`
+	BlockHeight    uint32 `json:"blockHeight"`
+
+	// TransferChainLength is the number of proofs in the file, the
+	// issuance included.
+	TransferChainLength uint32 `json:"transferChainLength"`
+}
+
+func newProvenAsset(p *taprpc.DecodedProof) provenAsset {
+	a := p.Asset
+	proven := provenAsset{
+		AssetID:             hex.EncodeToString(a.AssetGenesis.AssetId),
+		AssetName:           a.AssetGenesis.Name,
+		GenesisPoint:        a.AssetGenesis.GenesisPoint,
+		Amount:              a.Amount,
+		ScriptKey:           hex.EncodeToString(a.ScriptKey),
+		TransferChainLength: p.NumberOfProofs,
+	}
+	if a.AssetGroup != nil {
+		proven.GroupKey = hex.EncodeToString(a.AssetGroup.TweakedGroupKey)
+	}
+	if a.ChainAnchor != nil {
+		proven.AnchorOutpoint = a.ChainAnchor.AnchorOutpoint
+		proven.BlockHeight = a.ChainAnchor.BlockHeight
+	}
+
+	return proven
+}
+
+// VerifyProof checks a proof file against the asset it claims to be for,
+// named by asset ID or, for grouped assets, by group key. Names aren't unique,
+// so the genesis point the file is verified against always comes from our
+// universe's record of the asset ID the file actually ends in.
+func (h *Handler) VerifyProof(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AssetID      string `json:"assetId"`
+		GroupKey     string `json:"groupKey"`
+		RawProofFile []byte `json:"rawProofFile"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding verify proof request: %s", err.Error())
+		return
+	}
+	if (req.AssetID == "") == (req.GroupKey == "") {
+		writeError(w, http.StatusBadRequest, "exactly one of assetId and groupKey is required")
+		return
+	}
+	if len(req.RawProofFile) == 0 {
+		writeError(w, http.StatusBadRequest, "rawProofFile is required")
+		return
+	}
+
+	var groupKey []byte
+	if req.GroupKey != "" {
+		groupKey, err = hex.DecodeString(req.GroupKey)
+		if err != nil || (len(groupKey) != 32 && len(groupKey) != 33) {
+			writeError(w, http.StatusBadRequest, "invalid group key %q", req.GroupKey)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	decoded, err := h.tapClient.DecodeProof(ctx, &taprpc.DecodeProofRequest{
+		RawProof: req.RawProofFile,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadRequest, "error decoding proof file: %s", err.Error())
+		return
+	}
+	asset := decoded.DecodedProof.GetAsset()
+	if asset.GetAssetGenesis() == nil {
+		writeError(w, http.StatusBadRequest, "proof file has no asset")
+		return
+	}
+
+	assetID := hex.EncodeToString(asset.AssetGenesis.AssetId)
+	switch {
+	case req.AssetID != "" && !strings.EqualFold(req.AssetID, assetID):
+		writeError(w, http.StatusBadRequest, "proof is for asset %s, not %s", assetID, req.AssetID)
+		return
+
+	case groupKey != nil && !sameGroupKey(asset.AssetGroup.GetTweakedGroupKey(), groupKey):
+		writeError(w, http.StatusBadRequest, "proof is not for an asset of group %s", req.GroupKey)
+		return
+	}
+
+	universeAsset, universeGroupKey, err := h.lookupAssetByID(ctx, asset.AssetGenesis.AssetId)
+	if errors.Is(err, errAssetNotFound) {
+		writeError(w, http.StatusBadRequest, "asset %s not found", assetID)
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadGateway, "%s", err.Error())
+		return
+	}
+	if groupKey != nil && !sameGroupKey(universeGroupKey, groupKey) {
+		writeError(w, http.StatusBadRequest, "asset %s is not part of group %s", assetID, req.GroupKey)
+		return
+	}
+
+	verifyProofResp, err := h.tapClient.VerifyProof(ctx, &taprpc.ProofFile{
+		RawProofFile: req.RawProofFile,
+		GenesisPoint: universeAsset.GenesisPoint,
+	})
+	if err != nil {
+		writeUpstreamError(w, err, http.StatusBadRequest, "verify proof failed: %s", err.Error())
+		return
+	}
+	if !verifyProofResp.Valid {
+		writeError(w, http.StatusBadRequest, "proof is not valid")
+		return
+	}
+
+	proofDetails := decoded.DecodedProof
+	if verifyProofResp.DecodedProof != nil {
+		proofDetails = verifyProofResp.DecodedProof
+	}
+	proven := newProvenAsset(proofDetails)
+
+	h.notify(ctx, webhook.EventProofVerified, proven, authedPubkey(r))
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool        `json:"success"`
+		Proof   provenAsset `json:"proof"`
+	}{
+		Success: true,
+		Proof:   proven,
+	})
+}
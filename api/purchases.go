@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc/codes"
+)
+
+// purchaseStates maps the state of a purchase's invoice to the purchase's.
+var purchaseStates = map[lnrpc.Invoice_InvoiceState]store.PurchaseState{
+	lnrpc.Invoice_OPEN:     store.PurchasePending,
+	lnrpc.Invoice_ACCEPTED: store.PurchaseAccepted,
+	lnrpc.Invoice_SETTLED:  store.PurchaseSettled,
+	lnrpc.Invoice_CANCELED: store.PurchaseCanceled,
+}
+
+// recordPurchasePayment updates the purchase paid through the invoice, if
+// there is one.
+func (h *Handler) recordPurchasePayment(ctx context.Context, invoice *lnrpc.Invoice) {
+	p := store.Purchase{
+		PaymentHash:        hex.EncodeToString(invoice.RHash),
+		State:              purchaseStates[invoice.State],
+		PaidSats:           uint64(invoice.AmtPaidSat),
+		SettledAssetAmount: settledAssetAmount(invoice),
+	}
+	if invoice.SettleDate != 0 {
+		p.SettledAt = time.Unix(invoice.SettleDate, 0)
+	}
+
+	_, err := h.store.UpdatePurchasePayment(ctx, p)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		fmt.Printf("error recording payment of purchase %s: %s\n", p.PaymentHash, err.Error())
+	}
+}
+
+// staleReconcileInterval is how often reconcilePurchases runs.
+const staleReconcileInterval = time.Minute
+
+// reconcilePurchases regularly looks up the invoices of unfinished purchases
+// made over invoiceExpiry ago, which lnd has canceled unless they were paid.
+// Their watches normally report that, this catches purchases whose watch
+// gave up. Invoices lnd no longer knows can't be paid, their purchases are
+// canceled.
+func (h *Handler) reconcilePurchases(ctx context.Context) {
+	ticker := time.NewTicker(staleReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purchases, err := h.store.UnfinishedPurchases(ctx)
+		if err != nil {
+			fmt.Printf("error reconciling purchases: %s\n", err.Error())
+			continue
+		}
+
+		expired := time.Now().Add(-invoiceExpiry)
+		for _, p := range purchases {
+			if p.CreatedAt.After(expired) {
+				continue
+			}
+			h.reconcilePurchase(ctx, p)
+		}
+	}
+}
+
+func (h *Handler) reconcilePurchase(ctx context.Context, p store.Purchase) {
+	hash, err := parsePaymentHash(p.PaymentHash)
+	if err != nil {
+		return
+	}
+
+	invoice, err := h.lightningClient.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: hash})
+	if s, ok := grpcStatus(err); ok && s.Code() == codes.NotFound {
+		invoice = &lnrpc.Invoice{RHash: hash, State: lnrpc.Invoice_CANCELED}
+	} else if err != nil {
+		fmt.Printf("error looking up invoice of purchase %d: %s\n", p.ID, err.Error())
+		return
+	}
+
+	h.recordPurchasePayment(ctx, invoice)
+}
+
+// parsePurchaseFilter reads the filters of the purchase routes. Callers only
+// ever see purchases they bought or sold, role narrows that down to one of
+// the two.
+func parsePurchaseFilter(q url.Values, pubkey string) (store.PurchaseFilter, error) {
+	var f store.PurchaseFilter
+	switch role := q.Get("role"); role {
+	case "":
+		f.Pubkey = pubkey
+	case "buyer":
+		f.BuyerPubkey = pubkey
+	case "seller":
+		f.SellerPubkey = pubkey
+	default:
+		return f, fmt.Errorf("invalid role %q, expected buyer or seller", role)
+	}
+
+	f.AssetID = strings.ToLower(q.Get("assetId"))
+	switch state := store.PurchaseState(q.Get("state")); state {
+	case "", store.PurchasePending, store.PurchaseAccepted, store.PurchaseSettled, store.PurchaseCanceled:
+		f.State = state
+	default:
+		return f, fmt.Errorf("invalid state %q", state)
+	}
+
+	for name, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s %q, expected an RFC 3339 time", name, v)
+		}
+		*t = parsed
+	}
+
+	return f, nil
+}
+
+// ListPurchases lists the caller's purchases and sales, newest first.
+func (h *Handler) ListPurchases(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := parsePage(q)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid offset or limit, limit must be between 1 and %d", maxPageLimit)
+		return
+	}
+	f, err := parsePurchaseFilter(q, authedPubkey(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	f.Offset, f.Limit = p.Offset, p.Limit
+
+	purchases, err := h.store.ListPurchases(r.Context(), f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Purchases []store.Purchase `json:"purchases"`
+		Page      page             `json:"page"`
+	}{
+		Purchases: purchases,
+		Page:      p,
+	})
+}
+
+// purchaseCSVHeader is the header row of a CSV purchase export.
+var purchaseCSVHeader = []string{
+	"id", "created_at", "settled_at", "state", "buyer_pubkey",
+	"seller_pubkey", "asset_id", "asset_amount", "settled_asset_amount",
+	"invoice_sats", "paid_sats", "rate_coefficient", "rate_scale", "quote_id",
+	"payment_hash",
+}
+
+func purchaseCSVRow(p store.Purchase) []string {
+	var settledAt string
+	if !p.SettledAt.IsZero() {
+		settledAt = p.SettledAt.UTC().Format(time.RFC3339)
+	}
+
+	return []string{
+		strconv.FormatInt(p.ID, 10),
+		p.CreatedAt.UTC().Format(time.RFC3339),
+		settledAt,
+		string(p.State),
+		p.BuyerPubkey,
+		p.SellerPubkey,
+		p.AssetID,
+		strconv.FormatUint(p.AssetAmount, 10),
+		strconv.FormatUint(p.SettledAssetAmount, 10),
+		strconv.FormatUint(p.InvoiceSats, 10),
+		strconv.FormatUint(p.PaidSats, 10),
+		p.RateCoefficient,
+		strconv.FormatUint(uint64(p.RateScale), 10),
+		p.QuoteID,
+		p.PaymentHash,
+	}
+}
+
+// ExportPurchases downloads every one of the caller's purchases and sales
+// matching the filters, as CSV or JSON.
+func (h *Handler) ExportPurchases(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeError(w, http.StatusBadRequest, "invalid format %q, expected csv or json", format)
+		return
+	}
+	f, err := parsePurchaseFilter(q, authedPubkey(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	purchases, err := h.store.ListPurchases(r.Context(), f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="purchases.%s"`, format))
+	if format == "json" {
+		writeJSON(w, http.StatusOK, struct {
+			Purchases []store.Purchase `json:"purchases"`
+		}{
+			Purchases: purchases,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+	cw := csv.NewWriter(w)
+	cw.Write(purchaseCSVHeader)
+	for _, p := range purchases {
+		cw.Write(purchaseCSVRow(p))
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		fmt.Printf("error writing purchase export: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"TapHub/store"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+const (
+	// reputationWindow is how far back a node's reputation looks.
+	reputationWindow = 90 * 24 * time.Hour
+
+	// uptimeSampleInterval is how often every registered node is checked
+	// for being up.
+	uptimeSampleInterval = 10 * time.Minute
+
+	// expiryInterval is how often channel requests past their expiry are
+	// moved into the expired state, for their sellers' reputations.
+	expiryInterval = time.Minute
+
+	// fastCompletion is how quickly a channel request has to be completed
+	// on average to score full marks for latency. Slower averages lose
+	// marks until channelRequestTTL, when requests expire.
+	fastCompletion = time.Hour
+
+	// recentVerifications is how many holdings proof outcomes
+	// /getNodeReputation returns.
+	recentVerifications = 20
+)
+
+// Reputation components and their weights, which add up to the maximum
+// score of 100.
+const (
+	componentCompletion = "completion"
+	componentLatency    = "latency"
+	componentProofs     = "proofs"
+	componentUptime     = "uptime"
+)
+
+var componentWeights = map[string]float64{
+	componentCompletion: 40,
+	componentLatency:    20,
+	componentProofs:     20,
+	componentUptime:     20,
+}
+
+// reputation is how far buyers can trust a node to deliver, along with
+// everything the score was worked out from so it can be checked.
+type reputation struct {
+	// Score is between 0 and 100.
+	Score      float64                `json:"score"`
+	Components []reputationComponent  `json:"components"`
+	Inputs     store.ReputationInputs `json:"inputs"`
+}
+
+// reputationComponent is one part of a reputation score. Value is between
+// 0 and 1 and contributes Value * Weight to the score. Components without
+// any data to go by are neutral, with a Value of 0.5.
+type reputationComponent struct {
+	Name    string  `json:"name"`
+	Weight  float64 `json:"weight"`
+	Value   float64 `json:"value"`
+	HasData bool    `json:"hasData"`
+}
+
+// ratio returns the share of good in total, or false if there is nothing to
+// go by.
+func ratio(good, total int) (float64, bool) {
+	if total == 0 {
+		return 0.5, false
+	}
+	return float64(good) / float64(total), true
+}
+
+// newReputation scores a node from its reputation inputs.
+func newReputation(in store.ReputationInputs) reputation {
+	completion, hasCompletion := ratio(in.CompletedRequests, in.CompletedRequests+in.ExpiredRequests)
+
+	latency, hasLatency := 0.5, in.CompletedRequests > 0
+	if hasLatency {
+		avg := time.Duration(in.AvgCompletionSeconds) * time.Second
+		latency = 1 - float64(avg-fastCompletion)/float64(channelRequestTTL-fastCompletion)
+		latency = math.Max(0, math.Min(1, latency))
+	}
+
+	proofs, hasProofs := ratio(in.ValidProofs, in.ValidProofs+in.InvalidProofs)
+	uptime, hasUptime := ratio(in.UpSamples, in.UptimeSamples)
+
+	rep := reputation{
+		Components: []reputationComponent{
+			{Name: componentCompletion, Value: completion, HasData: hasCompletion},
+			{Name: componentLatency, Value: latency, HasData: hasLatency},
+			{Name: componentProofs, Value: proofs, HasData: hasProofs},
+			{Name: componentUptime, Value: uptime, HasData: hasUptime},
+		},
+		Inputs: in,
+	}
+	for i, c := range rep.Components {
+		rep.Components[i].Weight = componentWeights[c.Name]
+		rep.Score += c.Value * componentWeights[c.Name]
+	}
+	rep.Score = math.Round(rep.Score*10) / 10
+
+	return rep
+}
+
+// reputations works out the reputation of each of the nodes.
+func (h *Handler) reputations(ctx context.Context, pubkeys ...string) (map[string]*reputation, error) {
+	now := time.Now()
+	reps := make(map[string]*reputation, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		if _, ok := reps[pubkey]; ok {
+			continue
+		}
+		in, err := h.store.ReputationInputs(ctx, pubkey, now.Add(-reputationWindow))
+		if err != nil {
+			return nil, err
+		}
+		rep := newReputation(*in)
+		reps[pubkey] = &rep
+	}
+
+	return reps, nil
+}
+
+// recordHoldingsVerification keeps the outcome of a holdings proof for the
+// node's reputation. reason is empty for valid proofs.
+func (h *Handler) recordHoldingsVerification(ctx context.Context, listing *store.Listing, reason string) {
+	err := h.store.RecordHoldingsVerification(ctx, store.HoldingsVerification{
+		NodePubkey: listing.NodePubkey,
+		ListingID:  listing.ID,
+		AssetID:    listing.AssetID,
+		Valid:      reason == "",
+		Reason:     reason,
+		VerifiedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("reputation: %s\n", err)
+	}
+}
+
+// sampleUptime checks every registered node for being up, every
+// uptimeSampleInterval until ctx is cancelled.
+func (h *Handler) sampleUptime(ctx context.Context) {
+	ticker := time.NewTicker(uptimeSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Without the graph there's nothing to tell up from down.
+		if !h.graph.Ready() {
+			continue
+		}
+		nodes, err := h.store.ListNodes(ctx)
+		if err != nil {
+			log.Printf("reputation: %s\n", err)
+			continue
+		}
+
+		now := time.Now()
+		for _, n := range nodes {
+			edges, err := h.graph.ChannelsOf(n.Pubkey)
+			if err != nil {
+				log.Printf("reputation: %s\n", err)
+				break
+			}
+			if err := h.store.RecordUptimeSample(ctx, n.Pubkey, now, isUp(n.Pubkey, edges)); err != nil {
+				log.Printf("reputation: %s\n", err)
+			}
+		}
+	}
+}
+
+// expireChannelRequests expires the channel requests past their expiry,
+// every expiryInterval until ctx is cancelled, so abandoned requests count
+// against their sellers without anyone looking at them first.
+func (h *Handler) expireChannelRequests(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := h.store.ExpireChannelRequests(ctx, time.Now()); err != nil {
+			log.Printf("reputation: %s\n", err)
+		}
+	}
+}
+
+// isUp reports whether any of the node's peers has its side of their channel
+// enabled. Peers disable their side of a channel when the node goes offline,
+// so a node whose channels are all disabled from the other end is down.
+func isUp(pubkey string, edges []*lnrpc.ChannelEdge) bool {
+	for _, e := range edges {
+		peerPolicy := e.Node1Policy
+		if e.Node1Pub == pubkey {
+			peerPolicy = e.Node2Policy
+		}
+		if peerPolicy != nil && !peerPolicy.Disabled {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetNodeReputation returns a registered node's reputation, the inputs it
+// was worked out from and the node's most recent holdings proofs.
+func (h *Handler) GetNodeReputation(w http.ResponseWriter, r *http.Request) {
+	pubkey := r.URL.Query().Get("pubkey")
+	if pubkey == "" {
+		writeError(w, http.StatusBadRequest, "pubkey is required")
+		return
+	}
+
+	ctx := r.Context()
+	_, err := h.store.GetNode(ctx, pubkey)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "node %s not found", pubkey)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	reps, err := h.reputations(ctx, pubkey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	verifications, err := h.store.ListHoldingsVerifications(ctx, pubkey, recentVerifications)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Pubkey        string                       `json:"pubkey"`
+		Reputation    *reputation                  `json:"reputation"`
+		Verifications []store.HoldingsVerification `json:"verifications"`
+	}{
+		Pubkey:        pubkey,
+		Reputation:    reps[pubkey],
+		Verifications: verifications,
+	})
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes, one per kind of failure, so clients can tell failures apart
+// without parsing messages.
+const (
+	codeInvalidRequest      = "invalid_request"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeNotFound            = "not_found"
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeConflict            = "conflict"
+	codeRequestTooLarge     = "request_too_large"
+	codeRateLimited         = "rate_limited"
+	codeInternal            = "internal_error"
+	codeUpstreamError       = "upstream_error"
+	codeUpstreamUnavailable = "upstream_unavailable"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeInvalidRequest,
+	http.StatusUnauthorized:          codeUnauthorized,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusMethodNotAllowed:      codeMethodNotAllowed,
+	http.StatusConflict:              codeConflict,
+	http.StatusRequestEntityTooLarge: codeRequestTooLarge,
+	http.StatusTooManyRequests:       codeRateLimited,
+	http.StatusInternalServerError:   codeInternal,
+	http.StatusBadGateway:            codeUpstreamError,
+	http.StatusServiceUnavailable:    codeUpstreamUnavailable,
+}
+
+// apiError is the body of every error response, wrapped in {"error": ...}.
+type apiError struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// writeJSON writes v as the JSON body of the response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("error encoding response: %s\n", err.Error())
+	}
+}
+
+// writeError writes an error response with the given status and the code
+// that goes with it.
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeErrorDetails(w, status, nil, format, args...)
+}
+
+// writeErrorDetails is writeError with details that help the client act on
+// the error.
+func writeErrorDetails(w http.ResponseWriter, status int, details map[string]any, format string, args ...any) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = codeInternal
+	}
+
+	writeJSON(w, status, struct {
+		Error apiError `json:"error"`
+	}{
+		Error: apiError{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+			Details: details,
+		},
+	})
+}
+
+// writeUpstreamError writes an error response for a failed lnd or tapd call.
+// If the daemon couldn't be reached or is overloaded the status is 503,
+// otherwise it is the given status, usually 502, or 400 for calls that fail
+// when the client hands us bad input.
+func writeUpstreamError(w http.ResponseWriter, err error, status int, format string, args ...any) {
+	s, ok := grpcStatus(err)
+	if !ok {
+		writeError(w, status, format, args...)
+		return
+	}
+
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Canceled:
+		status = http.StatusServiceUnavailable
+	}
+	writeErrorDetails(w, status, map[string]any{
+		"grpcCode": s.Code().String(),
+	}, format, args...)
+}
+
+// grpcStatus returns the gRPC status err carries, if any.
+func grpcStatus(err error) (*status.Status, bool) {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() == codes.OK {
+		return nil, false
+	}
+	return s, true
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the path every route of the current API version lives under.
+const APIPrefix = "/v1"
+
+// middleware wraps a route's handler, e.g. to require a session.
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// router dispatches requests by exact path and method. Unlike
+// http.ServeMux it answers unknown paths and methods with the API's error
+// envelope.
+type router struct {
+	prefix string
+	routes map[string]map[string]http.HandlerFunc
+}
+
+func newRouter(prefix string) *router {
+	return &router{
+		prefix: prefix,
+		routes: make(map[string]map[string]http.HandlerFunc),
+	}
+}
+
+// handle registers next for method requests to path, wrapped in mws with the
+// first one outermost.
+func (rt *router) handle(method, path string, next http.HandlerFunc, mws ...middleware) {
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
+	}
+
+	methods, ok := rt.routes[rt.prefix+path]
+	if !ok {
+		methods = make(map[string]http.HandlerFunc)
+		rt.routes[rt.prefix+path] = methods
+	}
+	methods[method] = next
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		slog.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+	}()
+
+	methods, ok := rt.routes[r.URL.Path]
+	if !ok {
+		writeError(rec, http.StatusNotFound, "no such route %s", r.URL.Path)
+		return
+	}
+	next, ok := methods[r.Method]
+	if !ok {
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		slices.Sort(allowed)
+		rec.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(rec, http.StatusMethodNotAllowed, "%s only allows %s", r.URL.Path, strings.Join(allowed, ", "))
+		return
+	}
+
+	next(rec, r)
+}
+
+// statusRecorder remembers the status of the response written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
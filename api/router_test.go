@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodeError decodes the error envelope of a response.
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) apiError {
+	t.Helper()
+
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding error response: %s", err)
+	}
+
+	return body.Error
+}
+
+func TestRouter(t *testing.T) {
+	rt := newRouter(APIPrefix)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	rt.handle(http.MethodGet, "/getListing", ok)
+	rt.handle(http.MethodPut, "/listing", ok)
+	rt.handle(http.MethodDelete, "/listing", ok)
+	rt.handle(http.MethodPost, "/listing", ok)
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantAllow    string
+		wantCode     string
+	}{
+		{http.MethodGet, "/v1/getListing", http.StatusNoContent, "", ""},
+		{http.MethodDelete, "/v1/listing", http.StatusNoContent, "", ""},
+		{http.MethodPost, "/v1/getListing", http.StatusMethodNotAllowed, "GET", codeMethodNotAllowed},
+		{http.MethodGet, "/v1/listing", http.StatusMethodNotAllowed, "DELETE, POST, PUT", codeMethodNotAllowed},
+		{http.MethodGet, "/getListing", http.StatusNotFound, "", codeNotFound},
+		{http.MethodGet, "/v1/getListing/", http.StatusNotFound, "", codeNotFound},
+		{http.MethodGet, "/v1/nope", http.StatusNotFound, "", codeNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, test.wantStatus)
+			}
+			if got := w.Header().Get("Allow"); got != test.wantAllow {
+				t.Errorf("Allow %q, want %q", got, test.wantAllow)
+			}
+			if test.wantCode == "" {
+				return
+			}
+			if got := decodeError(t, w); got.Code != test.wantCode {
+				t.Errorf("error code %q, want %q", got.Code, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var calls []string
+	mw := func(name string) middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next(w, r)
+			}
+		}
+	}
+
+	rt := newRouter(APIPrefix)
+	rt.handle(http.MethodGet, "/livez", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}, mw("first"), mw("second"))
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/livez", nil))
+
+	if got, want := strings.Join(calls, ","), "first,second,handler"; got != want {
+		t.Fatalf("calls %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// streamHeartbeat is how often an idle stream gets a comment line, to keep
+// proxies from timing the connection out.
+const streamHeartbeat = 15 * time.Second
+
+// StreamPath is the path of the live event stream under APIPrefix.
+const StreamPath = "/events"
+
+// Events is a server-sent event stream of oracle price updates, and of the
+// channel opens and closes and purchase invoice state changes concerning the
+// caller's node, as they happen.
+//
+// Query parameters narrow the stream down: types is a comma separated list of
+// event types and paymentHash limits invoice events to that invoice.
+func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var types []string
+	if t := q.Get("types"); t != "" {
+		types = strings.Split(t, ",")
+	}
+	paymentHash := q.Get("paymentHash")
+	pubkey := authedPubkey(r)
+
+	wanted := func(e streamEvent) bool {
+		if len(types) > 0 && !slices.Contains(types, e.Type) {
+			return false
+		}
+		if e.Type == streamPrice {
+			return true
+		}
+		if !slices.Contains(e.Pubkeys, pubkey) {
+			return false
+		}
+		if paymentHash != "" && e.Type == streamInvoice {
+			return strings.EqualFold(e.PaymentHash, paymentHash)
+		}
+		return true
+	}
+
+	flusher, ok := startStream(w)
+	if !ok {
+		return
+	}
+
+	events, cancel := h.events.subscribe()
+	defer cancel()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !wanted(e) {
+				continue
+			}
+
+			writeStreamEvent(w, flusher, e.Type, e.Data)
+		}
+	}
+}
+
+// startStream writes the headers of a server-sent event stream. If the
+// response can't be streamed it writes an error instead.
+func startStream(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return flusher, true
+}
+
+// writeStreamEvent writes data as a server-sent event of the given type.
+func writeStreamEvent(w http.ResponseWriter, flusher http.Flusher, eventType string, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("error encoding %s stream event: %s\n", eventType, err.Error())
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, b)
+	flusher.Flush()
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
+)
+
+var (
+	// errAssetNotFound is returned when the universe doesn't know about an
+	// asset.
+	errAssetNotFound = errors.New("asset not found in universe")
+
+	// errInvalidAssetID is returned for asset IDs that aren't 32 hex encoded
+	// bytes.
+	errInvalidAssetID = errors.New("invalid asset id")
+)
+
+// lookupAsset finds the asset with the given hex encoded ID in our universe.
+func (h *Handler) lookupAsset(ctx context.Context, assetID string) (*universerpc.AssetStatsAsset, error) {
+	id, err := hex.DecodeString(assetID)
+	if err != nil || len(id) != 32 {
+		return nil, fmt.Errorf("%w %q", errInvalidAssetID, assetID)
+	}
+
+	asset, _, err := h.lookupAssetByID(ctx, id)
+
+	return asset, err
+}
+
+// lookupAssetByID finds the asset with the given ID in our universe, along
+// with the key of the group it belongs to, if any.
+func (h *Handler) lookupAssetByID(ctx context.Context, id []byte) (*universerpc.AssetStatsAsset, []byte, error) {
+	assetsStatsResp, err := h.universeClient.QueryAssetStats(ctx, &universerpc.AssetStatsQuery{
+		AssetIdFilter: id,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying universe asset stats: %w", err)
+	}
+
+	for _, snapshot := range assetsStatsResp.AssetStats {
+		for _, asset := range []*universerpc.AssetStatsAsset{snapshot.Asset, snapshot.GroupAnchor} {
+			if asset != nil && bytes.Equal(asset.AssetId, id) {
+				return asset, snapshot.GroupKey, nil
+			}
+		}
+	}
+
+	return nil, nil, errAssetNotFound
+}
+
+// sameGroupKey compares two group keys, either of which may be given as a
+// 33 byte compressed or a 32 byte x-only key.
+func sameGroupKey(a, b []byte) bool {
+	xOnly := func(k []byte) []byte {
+		if len(k) == 33 {
+			return k[1:]
+		}
+		return k
+	}
+
+	return len(a) != 0 && bytes.Equal(xOnly(a), xOnly(b))
+}
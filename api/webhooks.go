@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"TapHub/store"
+	"TapHub/webhook"
+)
+
+// notify queues a webhook event for each of the given nodes. Failing to
+// queue is logged rather than failing the request that caused the event.
+func (h *Handler) notify(ctx context.Context, eventType string, data any, pubkeys ...string) {
+	for _, pubkey := range pubkeys {
+		if err := h.webhooks.Notify(ctx, pubkey, eventType, data); err != nil {
+			fmt.Printf("error queueing %s webhook for %s: %s\n", eventType, pubkey, err.Error())
+		}
+	}
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding create webhook request: %s", err.Error())
+		return
+	}
+
+	if err := webhook.CheckURL(r.Context(), req.URL); err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(webhook.EventTypes, event) {
+			writeError(w, http.StatusBadRequest, "unknown event type %q, must be one of %v", event, webhook.EventTypes)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	pubkey := authedPubkey(r)
+	registered, err := h.store.IsRegistered(ctx, pubkey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	if !registered {
+		writeError(w, http.StatusForbidden, "node %s must be registered before adding webhooks", pubkey)
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "error generating webhook secret: %s", err.Error())
+		return
+	}
+
+	wh, err := h.store.CreateWebhook(ctx, store.Webhook{
+		NodePubkey: pubkey,
+		URL:        req.URL,
+		Secret:     secret,
+		Events:     req.Events,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	// The secret is only ever returned here, the receiver needs it to
+	// check the signature on every delivery.
+	writeJSON(w, http.StatusOK, struct {
+		Webhook *store.Webhook `json:"webhook"`
+		Secret  string         `json:"secret"`
+	}{
+		Webhook: wh,
+		Secret:  secret,
+	})
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.store.ListWebhooks(r.Context(), authedPubkey(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Webhooks []store.Webhook `json:"webhooks"`
+	}{
+		Webhooks: webhooks,
+	})
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID int64 `json:"id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "error decoding delete webhook request: %s", err.Error())
+		return
+	}
+
+	err = h.store.DeleteWebhook(r.Context(), req.ID, authedPubkey(r))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "webhook %d not found", req.ID)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{
+		Success: true,
+	})
+}
+
+// ListWebhookDeliveries returns the delivery log of the caller's webhooks.
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := store.WebhookDeliveryFilter{
+		NodePubkey: authedPubkey(r),
+		Status:     store.DeliveryStatus(q.Get("status")),
+		Limit:      100,
+	}
+	if id := q.Get("webhookId"); id != "" {
+		webhookID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid webhook id %q", id)
+			return
+		}
+		f.WebhookID = webhookID
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit %q", limit)
+			return
+		}
+		f.Limit = n
+	}
+
+	deliveries, err := h.store.ListWebhookDeliveries(r.Context(), f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Deliveries []store.WebhookDelivery `json:"deliveries"`
+	}{
+		Deliveries: deliveries,
+	})
+}
@@ -0,0 +1,310 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/lightninglabs/taproot-assets/taprpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/assetwalletrpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/tapchannelrpc"
+	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/chainrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	"google.golang.org/grpc"
+)
+
+// All is the backend name that stands for every backend, for queries that
+// fan out across them.
+const All = "all"
+
+const (
+	// checkInterval is how often every backend's health is checked.
+	checkInterval = 30 * time.Second
+
+	// checkTimeout is how long each daemon gets to answer a health check.
+	checkTimeout = 10 * time.Second
+)
+
+// DaemonHealth is how one lnd or tapd answered its last health check.
+type DaemonHealth struct {
+	Reachable bool   `json:"reachable"`
+	Synced    bool   `json:"synced"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Health is the outcome of a backend's last health check. A backend is
+// healthy when both its daemons are reachable and synced to the chain.
+type Health struct {
+	Healthy        bool         `json:"healthy"`
+	CheckedAt      time.Time    `json:"checkedAt,omitzero"`
+	Lnd            DaemonHealth `json:"lnd"`
+	Tapd           DaemonHealth `json:"tapd"`
+	IdentityPubkey string       `json:"identityPubkey,omitempty"`
+	BlockHeight    uint32       `json:"blockHeight,omitempty"`
+}
+
+// Backend is a connected lnd and tapd pair.
+type Backend struct {
+	Name    string
+	Network string
+
+	Lightning   lnrpc.LightningClient
+	Chain       chainrpc.ChainNotifierClient
+	Invoices    invoicesrpc.InvoicesClient
+	Taproot     taprpc.TaprootAssetsClient
+	AssetWallet assetwalletrpc.AssetWalletClient
+	TapChannels tapchannelrpc.TaprootAssetChannelsClient
+	Universe    universerpc.UniverseClient
+
+	lndConn  *grpc.ClientConn
+	tapdConn *grpc.ClientConn
+
+	// bitcoind is nil unless the backend was configured with one.
+	bitcoind *rpcclient.Client
+
+	mu     sync.Mutex
+	health Health
+}
+
+// connect dials the backend's daemons. Dialing doesn't wait for them to
+// answer, health checks find out whether they do.
+func connect(c Config) (*Backend, error) {
+	lndConn, err := dial(c.Lnd)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to lnd of backend %s: %w", c.Name, err)
+	}
+	tapdConn, err := dial(c.Tapd)
+	if err != nil {
+		lndConn.Close()
+		return nil, fmt.Errorf("error connecting to tapd of backend %s: %w", c.Name, err)
+	}
+
+	var bitcoind *rpcclient.Client
+	if c.Bitcoind != nil {
+		bitcoind, err = dialBitcoind(*c.Bitcoind)
+		if err != nil {
+			lndConn.Close()
+			tapdConn.Close()
+			return nil, fmt.Errorf("error connecting to bitcoind of backend %s: %w", c.Name, err)
+		}
+	}
+
+	return &Backend{
+		Name:        c.Name,
+		Network:     c.Network,
+		Lightning:   lnrpc.NewLightningClient(lndConn),
+		Chain:       chainrpc.NewChainNotifierClient(lndConn),
+		Invoices:    invoicesrpc.NewInvoicesClient(lndConn),
+		Taproot:     taprpc.NewTaprootAssetsClient(tapdConn),
+		AssetWallet: assetwalletrpc.NewAssetWalletClient(tapdConn),
+		TapChannels: tapchannelrpc.NewTaprootAssetChannelsClient(tapdConn),
+		Universe:    universerpc.NewUniverseClient(tapdConn),
+		lndConn:     lndConn,
+		tapdConn:    tapdConn,
+		bitcoind:    bitcoind,
+	}, nil
+}
+
+// Health returns the outcome of the backend's last health check.
+func (b *Backend) Health() Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.health
+}
+
+// Check asks both daemons how they are doing and keeps the outcome as the
+// backend's health.
+func (b *Backend) Check(ctx context.Context) Health {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	health := Health{CheckedAt: time.Now()}
+
+	lndInfo, err := b.Lightning.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+	if err != nil {
+		health.Lnd.Error = err.Error()
+	} else {
+		health.Lnd = DaemonHealth{
+			Reachable: true,
+			Synced:    lndInfo.SyncedToChain,
+			Version:   lndInfo.Version,
+		}
+		health.IdentityPubkey = lndInfo.IdentityPubkey
+		health.BlockHeight = lndInfo.BlockHeight
+		if !lndInfo.SyncedToChain {
+			health.Lnd.Error = "not synced to chain"
+		}
+		for _, chain := range lndInfo.Chains {
+			if chain.Network != b.Network {
+				health.Lnd.Synced = false
+				health.Lnd.Error = fmt.Sprintf("running on %s, configured for %s", chain.Network, b.Network)
+			}
+		}
+	}
+
+	tapdInfo, err := b.Taproot.GetInfo(ctx, &taprpc.GetInfoRequest{})
+	if err != nil {
+		health.Tapd.Error = err.Error()
+	} else {
+		// tapd follows the chain through lnd, it is as synced as lnd
+		// is.
+		health.Tapd = DaemonHealth{
+			Reachable: true,
+			Synced:    health.Lnd.Synced,
+			Version:   tapdInfo.Version,
+		}
+		if tapdInfo.Network != b.Network {
+			health.Tapd.Synced = false
+			health.Tapd.Error = fmt.Sprintf("running on %s, configured for %s", tapdInfo.Network, b.Network)
+		}
+	}
+
+	health.Healthy = health.Lnd.Synced && health.Tapd.Synced
+
+	b.mu.Lock()
+	b.health = health
+	b.mu.Unlock()
+
+	return health
+}
+
+func (b *Backend) close() {
+	b.lndConn.Close()
+	b.tapdConn.Close()
+	if b.bitcoind != nil {
+		b.bitcoind.Shutdown()
+	}
+}
+
+// Pool holds a connection to every configured backend. One of them is the
+// default, used by whatever isn't asked to run on a particular backend.
+type Pool struct {
+	backends []*Backend
+	byName   map[string]*Backend
+	def      *Backend
+}
+
+// NewPool connects to every backend. defaultName picks the default backend,
+// the first one if empty.
+func NewPool(configs []Config, defaultName string) (*Pool, error) {
+	if err := validate(configs); err != nil {
+		return nil, err
+	}
+
+	p := &Pool{byName: make(map[string]*Backend, len(configs))}
+	for _, c := range configs {
+		b, err := connect(c)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.backends = append(p.backends, b)
+		p.byName[b.Name] = b
+	}
+
+	p.def = p.backends[0]
+	if defaultName != "" {
+		def, ok := p.byName[defaultName]
+		if !ok {
+			p.Close()
+			return nil, fmt.Errorf("default backend %s isn't configured", defaultName)
+		}
+		p.def = def
+	}
+
+	return p, nil
+}
+
+// Default returns the default backend.
+func (p *Pool) Default() *Backend {
+	return p.def
+}
+
+// Get returns the backend called name.
+func (p *Pool) Get(name string) (*Backend, bool) {
+	b, ok := p.byName[name]
+	return b, ok
+}
+
+// ForNetwork returns a backend running on network, preferring the default
+// and then healthy ones.
+func (p *Pool) ForNetwork(network string) (*Backend, bool) {
+	if p.def.Network == network && p.def.Health().Healthy {
+		return p.def, true
+	}
+
+	var found *Backend
+	for _, b := range p.backends {
+		if b.Network != network {
+			continue
+		}
+		if b.Health().Healthy {
+			return b, true
+		}
+		if found == nil {
+			found = b
+		}
+	}
+
+	return found, found != nil
+}
+
+// All returns every backend, in the order they were configured.
+func (p *Pool) All() []*Backend {
+	return p.backends
+}
+
+// CheckAll checks the health of every backend at once.
+func (p *Pool) CheckAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if h := b.Check(ctx); !h.Healthy {
+				log.Printf("backend: %s is unhealthy: %s\n", b.Name, errors.Join(
+					daemonError("lnd", h.Lnd), daemonError("tapd", h.Tapd),
+				))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func daemonError(daemon string, h DaemonHealth) error {
+	if h.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", daemon, h.Error)
+}
+
+// Run checks the health of every backend every checkInterval until ctx is
+// cancelled.
+func (p *Pool) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p.CheckAll(ctx)
+	}
+}
+
+// Close closes the connections to every backend.
+func (p *Pool) Close() {
+	for _, b := range p.backends {
+		b.close()
+	}
+}
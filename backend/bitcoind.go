@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrNoBitcoind is returned by Unspent for backends without a bitcoind to
+// look outputs up in.
+var ErrNoBitcoind = errors.New("no bitcoind configured")
+
+// BitcoindConfig is how to reach the JSON-RPC interface of the bitcoind a
+// backend's lnd runs on.
+type BitcoindConfig struct {
+	Host string `json:"host"`
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+// dialBitcoind sets up a client for bitcoind's JSON-RPC interface. Requests
+// are plain HTTP posts, nothing is sent until the first one.
+func dialBitcoind(c BitcoindConfig) (*rpcclient.Client, error) {
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         c.Host,
+		User:         c.User,
+		Pass:         c.Pass,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up bitcoind client for %v: %v", c.Host, err)
+	}
+
+	return client, nil
+}
+
+// Unspent reports whether the output is in bitcoind's UTXO set. Outputs
+// spent by a transaction in the mempool count as spent.
+func (b *Backend) Unspent(ctx context.Context, outpoint wire.OutPoint) (bool, error) {
+	if b.bitcoind == nil {
+		return false, ErrNoBitcoind
+	}
+
+	type txOut struct {
+		result *btcjson.GetTxOutResult
+		err    error
+	}
+	done := make(chan txOut, 1)
+	future := b.bitcoind.GetTxOutAsync(&outpoint.Hash, outpoint.Index, true)
+	go func() {
+		result, err := future.Receive()
+		done <- txOut{result, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case out := <-done:
+		if out.err != nil {
+			return false, fmt.Errorf("error looking up %s: %w", outpoint, out.err)
+		}
+		// gettxout answers null for outputs that are spent or never
+		// existed.
+		return out.result != nil, nil
+	}
+}
@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lightningnetwork/lnd/macaroons"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/macaroon.v2"
+)
+
+// DaemonConfig is how to reach one lnd or tapd. The TLS cert and macaroon
+// are taken from the hex fields when set, else read from the paths.
+type DaemonConfig struct {
+	Host         string `json:"host"`
+	TLSCertPath  string `json:"tlsCertPath,omitempty"`
+	MacaroonPath string `json:"macaroonPath,omitempty"`
+	TLSCertHex   string `json:"tlsCertHex,omitempty"`
+	MacaroonHex  string `json:"macaroonHex,omitempty"`
+}
+
+// Config is one named lnd and tapd pair, running on Network.
+type Config struct {
+	Name    string       `json:"name"`
+	Network string       `json:"network"`
+	Lnd     DaemonConfig `json:"lnd"`
+	Tapd    DaemonConfig `json:"tapd"`
+
+	// Bitcoind is where outputs are looked up in the UTXO set, for
+	// checking holdings proofs. Without it holdings can't be verified.
+	Bitcoind *BitcoindConfig `json:"bitcoind,omitempty"`
+}
+
+// LoadConfigs reads a JSON array of backend configs from the file at path.
+func LoadConfigs(path string) ([]Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backends file %s: %w", path, err)
+	}
+
+	var configs []Config
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, fmt.Errorf("error parsing backends file %s: %w", path, err)
+	}
+
+	return configs, nil
+}
+
+// validate checks the configs name distinct backends that say where to find
+// their daemons.
+func validate(configs []Config) error {
+	if len(configs) == 0 {
+		return errors.New("no backends configured")
+	}
+
+	seen := make(map[string]bool, len(configs))
+	for _, c := range configs {
+		switch {
+		case c.Name == "":
+			return errors.New("backend without a name")
+		case c.Name == All:
+			return fmt.Errorf("%q can't be used as a backend name", All)
+		case seen[c.Name]:
+			return fmt.Errorf("backend %s configured twice", c.Name)
+		case c.Network == "":
+			return fmt.Errorf("backend %s has no network", c.Name)
+		case c.Lnd.Host == "" || c.Tapd.Host == "":
+			return fmt.Errorf("backend %s needs both an lnd and a tapd host", c.Name)
+		case c.Bitcoind != nil && c.Bitcoind.Host == "":
+			return fmt.Errorf("backend %s has a bitcoind without a host", c.Name)
+		}
+		seen[c.Name] = true
+	}
+
+	return nil
+}
+
+// dial sets up a connection to the daemon, authenticated with its macaroon.
+func dial(c DaemonConfig) (*grpc.ClientConn, error) {
+	// Init client connection options.
+	var opts []grpc.DialOption
+
+	// Creds is to be populated directly from hex-encoded material
+	// or via a path.
+	var creds credentials.TransportCredentials
+
+	// Use provided hex.
+	if c.TLSCertHex != "" {
+		cp := x509.NewCertPool()
+		cert, err := hex.DecodeString(c.TLSCertHex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tls cert hex: %v", err)
+		}
+
+		cp.AppendCertsFromPEM(cert)
+		creds = credentials.NewClientTLSFromCert(cp, "")
+
+		// Else, read from filepath.
+	} else if c.TLSCertPath != "" {
+		credFile, err := credentials.NewClientTLSFromFile(c.TLSCertPath, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls cert file: %v", err)
+		}
+		creds = credFile
+	} else {
+		return nil, fmt.Errorf("no tls cert provided")
+	}
+
+	// Append the tls cert as a dial option.
+	opts = append(opts, grpc.WithTransportCredentials(creds))
+
+	// Populated macaroon auth material.
+	var rawMacaroon []byte
+	if c.MacaroonHex != "" {
+		// Use provided hex.
+		macBytes, err := hex.DecodeString(c.MacaroonHex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode macaroon hex: %v", err)
+		}
+		// Set the bytes as the macaroon cred.
+		rawMacaroon = macBytes
+	} else if c.MacaroonPath != "" {
+		// Read in the macaroon.
+		rawMac, err := os.ReadFile(c.MacaroonPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read macaroon file: %v", err)
+		}
+		rawMacaroon = rawMac
+	} else {
+		// We have no path to obtaining the macaroon auth material.
+		return nil, fmt.Errorf("no macaroon provided")
+	}
+
+	// Unmarshal the raw macaroon bytes.
+	mac := &macaroon.Macaroon{}
+	if err := mac.UnmarshalBinary(rawMacaroon); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal macaroon: %v", err)
+	}
+	macCred, err := macaroons.NewMacaroonCredential(mac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create macaroon credential: %v", err)
+	}
+	// Append the macaroon as a dial option .
+	opts = append(opts, grpc.WithPerRPCCredentials(macCred))
+
+	// Initialize the connection.
+	conn, err := grpc.Dial(c.Host, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial node at %v: %v", c.Host, err)
+	}
+
+	return conn, nil
+}
@@ -2,28 +2,19 @@ package main
 
 import (
 	"TapHub/api"
+	"TapHub/backend"
+	"TapHub/graph"
+	"TapHub/monitor"
 	"TapHub/rfq"
+	"TapHub/store"
+	"TapHub/webhook"
 	"context"
-	"crypto/x509"
-	"encoding/hex"
 	"flag"
 	"fmt"
-	"log/slog"
 	"net/http"
-	"os"
+	"strings"
 
-	"github.com/lightningnetwork/lnd/lnrpc"
-
-	"github.com/lightninglabs/taproot-assets/taprpc"
-	"github.com/lightninglabs/taproot-assets/taprpc/universerpc"
-
-	"github.com/lightningnetwork/lnd/macaroons"
-	"github.com/linden/httplog"
 	"github.com/rs/cors"
-	"google.golang.org/grpc"
-
-	"google.golang.org/grpc/credentials"
-	"gopkg.in/macaroon.v2"
 )
 
 const TetherDir = "storeTetherLitd"
@@ -38,8 +29,16 @@ var tapMacaroonPath string
 var lndtTlsCertPath string
 var lndMacaroonPath string
 var network string
+var backendsPath string
+var defaultBackend string
+var bitcoindHost string
+var bitcoindUser string
+var bitcoindPass string
 var apiNinjaKey string
 var enableRfq bool
+var dbPath string
+var adminPubkeys string
+var limits = api.DefaultLimits()
 
 // go run main.go  -port=8085 -rpcserverLnd=127.0.0.1:10001 -rpcserverTap=127.0.0.1:12029 -tap-tlscertPath=/home/bob/.polar/networks/3/volumes/tapd/alice-tap/tls.cert -tap-macaroonPath=/home/bob/.polar/networks/3/volumes/tapd/alice-tap/data/regtest/admin.macaroon -lnd-tlscertPath=/home/bob/.polar/networks/3/volumes/lnd/alice/tls.cert -lnd-macaroonPath=/home/bob/.polar/networks/3/volumes/lnd/alice/data/chain/bitcoin/regtest/admin.macaroon -network=regtest -apiNinjaKey
 
@@ -54,8 +53,27 @@ func setFlags() {
 	flag.StringVar(&lndtTlsCertPath, "lnd-tlscertPath", "/home/bob/.lnd/tls.cert", "path to lnd tls cert")
 	flag.StringVar(&lndMacaroonPath, "lnd-macaroonPath", "/home/bob/.lnd/data/chain/bitcoin/testnet4/admin.macaroon", "path to lnd macaroon")
 	flag.StringVar(&network, "network", "testnet4", "which lightning network")
+	flag.StringVar(&backendsPath, "backends", "", "path to a JSON file listing named lnd/tapd backends, replaces the single backend given by the rpcserver, cert and macaroon flags")
+	flag.StringVar(&defaultBackend, "defaultBackend", "", "name of the backend used unless a request picks another, the first one if empty")
+	flag.StringVar(&bitcoindHost, "bitcoindHost", "", "host:port of the JSON-RPC interface of lnd's bitcoind, needed to verify holdings")
+	flag.StringVar(&bitcoindUser, "bitcoindUser", "", "bitcoind JSON-RPC user")
+	flag.StringVar(&bitcoindPass, "bitcoindPass", "", "bitcoind JSON-RPC password")
 	flag.StringVar(&apiNinjaKey, "apiNinjaKey", "", "api key for api-ninjas.com")
 	flag.BoolVar(&enableRfq, "enableRfq", false, "enables RFQ oracle to run")
+	flag.StringVar(&dbPath, "dbPath", "taphub.db", "path to the TapHub sqlite database")
+	flag.StringVar(&adminPubkeys, "adminPubkeys", "", "comma separated node pubkeys allowed to use the admin routes")
+	flag.Float64Var(&limits.IP.PerSecond, "rateLimitPerSecond", limits.IP.PerSecond, "requests per second allowed per client IP, 0 to turn off")
+	flag.IntVar(&limits.IP.Burst, "rateLimitBurst", limits.IP.Burst, "requests a client IP can make at once")
+	flag.Float64Var(&limits.VerifyIP.PerSecond, "verifyRateLimitPerSecond", limits.VerifyIP.PerSecond, "verification requests per second allowed per client IP, 0 to turn off")
+	flag.IntVar(&limits.VerifyIP.Burst, "verifyRateLimitBurst", limits.VerifyIP.Burst, "verification requests a client IP can make at once")
+	flag.Float64Var(&limits.VerifyPubkey.PerSecond, "verifyPubkeyRateLimitPerSecond", limits.VerifyPubkey.PerSecond, "verification requests per second allowed per node pubkey, 0 to turn off")
+	flag.IntVar(&limits.VerifyPubkey.Burst, "verifyPubkeyRateLimitBurst", limits.VerifyPubkey.Burst, "verification requests a node pubkey can make at once")
+	flag.Int64Var(&limits.MaxBodyBytes, "maxBodyBytes", limits.MaxBodyBytes, "largest request body accepted, 0 for no limit")
+	flag.Int64Var(&limits.MaxProofBodyBytes, "maxProofBodyBytes", limits.MaxProofBodyBytes, "largest request body accepted by the routes that take proof files, 0 for no limit")
+	flag.IntVar(&limits.TapdConcurrency, "tapdConcurrency", limits.TapdConcurrency, "requests allowed to call tapd at once, 0 for no limit")
+	flag.IntVar(&limits.InvoiceStreams, "invoiceStreams", limits.InvoiceStreams, "invoice streams allowed open at once, 0 for no limit")
+	flag.IntVar(&limits.InvoiceStreamsPerNode, "invoiceStreamsPerNode", limits.InvoiceStreamsPerNode, "invoice streams a node pubkey can have open at once, 0 for no limit")
+	flag.BoolVar(&limits.TrustForwardedFor, "trustForwardedFor", false, "take client IPs from the X-Forwarded-For header set by a proxy in front of TapHub")
 
 	flag.Parse()
 }
@@ -70,6 +88,7 @@ func main() {
 	fmt.Printf("lndtTlsCertPath: %s\n", lndtTlsCertPath)
 	fmt.Printf("lndMacaroonPath: %s\n", lndMacaroonPath)
 	fmt.Printf("network: %s\n", network)
+	fmt.Printf("dbPath: %s\n", dbPath)
 	var oracle *rfq.MarketDataConfig
 	var err error
 	if enableRfq {
@@ -83,37 +102,58 @@ func main() {
 		oracle.ServiceListenAddress = ""
 		fmt.Printf("\n\nRFQ disabled\n\n")
 	}
-	tapConn, err := setupNodeConn(rpcServerTap, tapMacaroonPath, tapTlsCertPath, "", "")
+	configs, err := backendConfigs()
 	if err != nil {
-		fmt.Println("error setting up tap connection: ", err)
+		fmt.Println("error loading backends: ", err)
 		return
 	}
-	lndConn, err := setupNodeConn(rpcServerLnd, lndMacaroonPath, lndtTlsCertPath, "", "")
+	backends, err := backend.NewPool(configs, defaultBackend)
 	if err != nil {
-		fmt.Println("error setting up lnd connection: ", err)
+		fmt.Println("error setting up backends: ", err)
 		return
 	}
-
-	ln := lnrpc.NewLightningClient(lndConn)
-	_, err = ln.GetInfo(context.Background(), &lnrpc.GetInfoRequest{})
-	if err != nil {
-		fmt.Println("error getting lnd info: ", err)
+	defer backends.Close()
+
+	// Only the default backend has to be up to start, the others are
+	// reported unhealthy until they come up.
+	backends.CheckAll(context.Background())
+	def := backends.Default()
+	if health := def.Health(); !health.Lnd.Reachable || !health.Tapd.Reachable {
+		fmt.Printf("default backend %s unreachable: lnd: %s, tapd: %s\n", def.Name, health.Lnd.Error, health.Tapd.Error)
 		return
 	}
-	tc := taprpc.NewTaprootAssetsClient(tapConn)
-	_, err = tc.GetInfo(context.Background(), &taprpc.GetInfoRequest{})
+	for _, b := range backends.All() {
+		fmt.Printf("backend %s on %s, healthy: %t\n", b.Name, b.Network, b.Health().Healthy)
+	}
+
+	db, err := store.Open(dbPath)
 	if err != nil {
-		fmt.Println("error getting tap info: ", err)
+		fmt.Println("error opening database: ", err)
 		return
 	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go backends.Run(ctx)
 
-	uc := universerpc.NewUniverseClient(tapConn)
+	// Registered nodes are followed through the default backend's graph.
+	channelGraph := graph.NewIndex(def.Lightning)
+	go channelGraph.Run(ctx)
 
-	apiHandler, err := api.New(ln, tc, uc, oracle.ProxyListenAddress, oracle.ServiceListenAddress, enableRfq)
+	mon := monitor.New(channelGraph, db)
+	go mon.Run(ctx)
+
+	webhooks := webhook.New(db)
+	go webhooks.Run(ctx)
+
+	apiHandler, err := api.New(backends, db, channelGraph, mon, webhooks, oracle, oracle.ProxyListenAddress, oracle.ServiceListenAddress, enableRfq, splitList(adminPubkeys), limits)
 	if err != nil {
 		fmt.Println("error setting up api: ", err)
 		return
 	}
+	apiHandler.Start(ctx)
 
 	// Create the CORs middleware, allowing everything.
 	m := cors.New(cors.Options{
@@ -121,12 +161,8 @@ func main() {
 			return true
 		},
 		AllowedMethods: []string{
-			http.MethodHead,
 			http.MethodGet,
 			http.MethodPost,
-			http.MethodPut,
-			http.MethodPatch,
-			http.MethodDelete,
 		},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: false,
@@ -134,14 +170,10 @@ func main() {
 
 	port := fmt.Sprintf(":%s", Port)
 
-	// Create a structured logger, with the prefix "httplog".
-	sl := slog.Default().WithGroup("httplog")
-
-	// Create our http logger.
-	hl := httplog.NewLogger(sl)
+	// Requests are logged by the api's router.
+	handler := m.Handler(apiHandler)
 
-	// Serve on port ":8080", using the logging middleware.
-	err = http.ListenAndServe(port, hl.Handler(m.Handler(apiHandler)))
+	err = http.ListenAndServe(port, handler)
 	if err != nil {
 		panic(err)
 	}
@@ -150,78 +182,46 @@ func main() {
 
 }
 
-func setupNodeConn(host string, macPath string, tlsCertPath string, macHex string, tlsHex string) (*grpc.ClientConn, error) {
-	// Init client connection options.
-	var opts []grpc.DialOption
-
-	// Creds is to be populated directly from hex-encoded material
-	// or via a path.
-	var creds credentials.TransportCredentials
-
-	// Use provided hex.
-	if tlsHex != "" {
-		cp := x509.NewCertPool()
-		cert, err := hex.DecodeString(tlsHex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode tls cert hex: %v", err)
-		}
-
-		cp.AppendCertsFromPEM(cert)
-		creds = credentials.NewClientTLSFromCert(cp, "")
-
-		// Else, read from filepath.
-	} else if tlsCertPath != "" {
-		credFile, err := credentials.NewClientTLSFromFile(tlsCertPath, "")
-		if err != nil {
-			return nil, fmt.Errorf("failed to read LND tls cert file: %v", err)
-		}
-		creds = credFile
-	} else {
-		return nil, fmt.Errorf("no tls cert provided")
+// backendConfigs returns the backends from the -backends file, or the single
+// backend described by the other flags when there is none.
+func backendConfigs() ([]backend.Config, error) {
+	if backendsPath != "" {
+		return backend.LoadConfigs(backendsPath)
 	}
 
-	// Append the tls cert as a dial option.
-	opts = append(opts, grpc.WithTransportCredentials(creds))
-
-	// Populated macaroon auth material.
-	var rawMacaroon []byte
-	if macHex != "" {
-		// Use provided hex.
-		macBytes, err := hex.DecodeString(macHex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode macaroon hex: %v", err)
+	var bitcoind *backend.BitcoindConfig
+	if bitcoindHost != "" {
+		bitcoind = &backend.BitcoindConfig{
+			Host: bitcoindHost,
+			User: bitcoindUser,
+			Pass: bitcoindPass,
 		}
-		// Set the bytes as the macaroon cred.
-		rawMacaroon = macBytes
-	} else if macPath != "" {
-		// Read in the macaroon.
-		rawMac, err := os.ReadFile(macPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read macaroon file: %v", err)
-		}
-		rawMacaroon = rawMac
-	} else {
-		// We have no path to obtaining the macaroon auth material.
-		return nil, fmt.Errorf("no macaroon provided")
 	}
 
-	// Unmarshal the raw macaroon bytes.
-	mac := &macaroon.Macaroon{}
-	if err := mac.UnmarshalBinary(rawMacaroon); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal macaroon: %v", err)
-	}
-	macCred, err := macaroons.NewMacaroonCredential(mac)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create macaroon credential: %v", err)
-	}
-	// Append the macaroon as a dial option .
-	opts = append(opts, grpc.WithPerRPCCredentials(macCred))
+	return []backend.Config{{
+		Name:    "default",
+		Network: network,
+		Lnd: backend.DaemonConfig{
+			Host:         rpcServerLnd,
+			TLSCertPath:  lndtTlsCertPath,
+			MacaroonPath: lndMacaroonPath,
+		},
+		Tapd: backend.DaemonConfig{
+			Host:         rpcServerTap,
+			TLSCertPath:  tapTlsCertPath,
+			MacaroonPath: tapMacaroonPath,
+		},
+		Bitcoind: bitcoind,
+	}}, nil
+}
 
-	// Initialize the connection.
-	conn, err := grpc.Dial(host, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial node at %v: %v", host, err)
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-
-	return conn, nil
+	return items
 }
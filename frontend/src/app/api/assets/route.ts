@@ -0,0 +1,33 @@
+import { NextRequest, NextResponse } from "next/server";
+
+// Proxies asset discovery to the backend, which reads the assets straight
+// from its universe. Supports the backend's name, search, type, sortBy,
+// direction, offset and limit query parameters.
+export async function GET(request: NextRequest) {
+  try {
+    const params = request.nextUrl.searchParams.toString();
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/listAssets?${params}`);
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to list assets', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const result = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      assets: result.assets,
+      page: result.page
+    });
+  } catch (error) {
+    console.error('Error listing assets:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
@@ -0,0 +1,29 @@
+import { NextResponse } from "next/server";
+
+// Proxies the backend's list of lnd/tapd backends and their health.
+export async function GET() {
+  try {
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/listBackends`);
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to list backends', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const data = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      ...data
+    });
+  } catch (error) {
+    console.error('Error listing backends:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
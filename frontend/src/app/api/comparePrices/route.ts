@@ -0,0 +1,41 @@
+import { NextRequest, NextResponse } from "next/server";
+
+// Proxies a live price comparison from the backend: every node listing the
+// asset is asked for its current price for the amount, cheapest first.
+export async function GET(request: NextRequest) {
+  try {
+    const assetId = request.nextUrl.searchParams.get('assetId');
+    const amount = request.nextUrl.searchParams.get('amount');
+
+    if (!assetId || !amount) {
+      return NextResponse.json(
+        { success: false, error: 'assetId and amount are required' },
+        { status: 400 }
+      );
+    }
+
+    const params = new URLSearchParams({ assetId, amount });
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/comparePrices?${params.toString()}`);
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to compare prices', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const data = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      ...data
+    });
+  } catch (error) {
+    console.error('Error comparing prices:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
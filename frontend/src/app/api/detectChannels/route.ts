@@ -12,7 +12,7 @@ export async function POST(request: NextRequest) {
     }
 
     // Call the backend API to detect channels
-    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/detectChannels`, {
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/detectChannels`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -23,23 +23,17 @@ export async function POST(request: NextRequest) {
     if (!backendResponse.ok) {
       const errorData = await backendResponse.json();
       return NextResponse.json(
-        { success: false, error: errorData.error || 'Channel detection failed' },
+        { success: false, error: errorData.error?.message || 'Channel detection failed', code: errorData.error?.code },
         { status: backendResponse.status }
       );
     }
 
     const detectionResult = await backendResponse.json();
     
-    if (detectionResult.error) {
-      return NextResponse.json(
-        { success: false, error: detectionResult.error },
-        { status: 400 }
-      );
-    }
-
     return NextResponse.json({ 
       success: true,
-      channels: detectionResult.channels || []
+      channels: detectionResult.channels || [],
+      channelDetails: detectionResult.channelDetails || []
     });
   } catch (error) {
     console.error('Error detecting channels:', error);
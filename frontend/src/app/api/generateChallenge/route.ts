@@ -1,15 +1,30 @@
-import { NextRequest, NextResponse } from "next/server";
-import crypto from "crypto";
+import { NextResponse } from "next/server";
 
-export async function POST(request: NextRequest) {
+export async function POST() {
   try {
-    const challenge = `TapHub Authentication: ${crypto.randomBytes(16).toString('hex')}`;
-    const timestamp = Date.now();
-    
+    // The backend issues and remembers the challenge so that a signature can
+    // only be redeemed once, and only before the challenge expires.
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/generateChallenge`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+    });
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to generate challenge', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const result = await backendResponse.json();
+
     return NextResponse.json({ 
       success: true,
-      challenge,
-      timestamp
+      challenge: result.challenge,
+      expiresAt: result.expiresAt
     });
   } catch (error) {
     console.error('Error generating challenge:', error);
@@ -18,4 +33,4 @@ export async function POST(request: NextRequest) {
       { status: 500 }
     );
   }
-}
\ No newline at end of file
+}
@@ -1,7 +1,29 @@
 import { NextResponse } from "next/server";
 import { withMongoConnection } from "../../utils/mongoUtils";
 
+// Asks the backend whether lnd, tapd, its database and its price oracle are
+// usable. The backend caches its answer briefly, so this is cheap to call.
+async function backendReadiness() {
+  try {
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/readyz`);
+    const data = await backendResponse.json();
+
+    // Not ready comes with a 503 and the full report, anything else is
+    // an error.
+    if (!backendResponse.ok && backendResponse.status !== 503) {
+      return { ready: false, error: data.error?.message || 'Failed to check backend readiness' };
+    }
+
+    return data;
+  } catch (error) {
+    console.error("Backend readiness check failed:", error);
+    return { ready: false, error: error instanceof Error ? error.message : "Backend unreachable" };
+  }
+}
+
 export async function GET() {
+  const backend = await backendReadiness();
+
   try {
     // Test the MongoDB connection
     const result = await withMongoConnection(async (db) => {
@@ -12,26 +34,28 @@ export async function GET() {
       const stats = await db.stats();
       
       return {
-        status: "healthy",
+        status: backend.ready ? "healthy" : "unhealthy",
         database: db.databaseName,
         collections: stats.collections,
         dataSize: stats.dataSize,
         storageSize: stats.storageSize,
         indexes: stats.indexes,
+        backend,
         timestamp: new Date().toISOString()
       };
     });
 
-    return NextResponse.json(result);
+    return NextResponse.json(result, { status: backend.ready ? 200 : 503 });
   } catch (error) {
     console.error("Health check failed:", error);
     return NextResponse.json(
       { 
         status: "unhealthy",
         error: error instanceof Error ? error.message : "Unknown error",
+        backend,
         timestamp: new Date().toISOString()
       },
       { status: 500 }
     );
   }
-} 
\ No newline at end of file
+}
@@ -0,0 +1,43 @@
+import { NextRequest, NextResponse } from "next/server";
+
+// Proxies the status of one of the caller's purchase invoices from the
+// backend: its state, the sats paid and the asset units settled.
+export async function GET(request: NextRequest) {
+  try {
+    const paymentHash = request.nextUrl.searchParams.get('paymentHash');
+
+    if (!paymentHash) {
+      return NextResponse.json(
+        { success: false, error: 'Payment hash is required' },
+        { status: 400 }
+      );
+    }
+
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/getInvoice?paymentHash=${encodeURIComponent(paymentHash)}`, {
+      headers: {
+        'Authorization': request.headers.get('Authorization') || '',
+      },
+    });
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to get invoice status', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const { invoice } = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      invoice
+    });
+  } catch (error) {
+    console.error('Error getting invoice status:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
@@ -0,0 +1,39 @@
+import { NextRequest, NextResponse } from "next/server";
+
+// Proxies a node's profile from the backend: its announcement, channels and
+// TapHub registration.
+export async function GET(request: NextRequest) {
+  try {
+    const pubkey = request.nextUrl.searchParams.get('pubkey');
+
+    if (!pubkey) {
+      return NextResponse.json(
+        { success: false, error: 'Pubkey is required' },
+        { status: 400 }
+      );
+    }
+
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/getNodeProfile?pubkey=${encodeURIComponent(pubkey)}`);
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to get node profile', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const profile = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      profile
+    });
+  } catch (error) {
+    console.error('Error getting node profile:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
@@ -0,0 +1,39 @@
+import { NextRequest, NextResponse } from "next/server";
+
+// Proxies a registered node's reputation from the backend, along with the
+// inputs it was worked out from.
+export async function GET(request: NextRequest) {
+  try {
+    const pubkey = request.nextUrl.searchParams.get('pubkey');
+
+    if (!pubkey) {
+      return NextResponse.json(
+        { success: false, error: 'Pubkey is required' },
+        { status: 400 }
+      );
+    }
+
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/getNodeReputation?pubkey=${encodeURIComponent(pubkey)}`);
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to get node reputation', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    const data = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      ...data
+    });
+  } catch (error) {
+    console.error('Error getting node reputation:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
@@ -0,0 +1,56 @@
+import { NextRequest, NextResponse } from "next/server";
+
+// Proxies the caller's purchase ledger from the backend. With export=csv or
+// export=json the backend's download is passed through as is, otherwise the
+// query parameters filter and page the list.
+export async function GET(request: NextRequest) {
+  try {
+    const params = new URLSearchParams(request.nextUrl.searchParams);
+    const format = params.get('export');
+    params.delete('export');
+
+    let path = '/v1/listPurchases';
+    if (format) {
+      params.set('format', format);
+      path = '/v1/exportPurchases';
+    }
+
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}${path}?${params.toString()}`, {
+      headers: {
+        'Authorization': request.headers.get('Authorization') || '',
+      },
+    });
+
+    if (!backendResponse.ok) {
+      const errorData = await backendResponse.json();
+      return NextResponse.json(
+        { success: false, error: errorData.error?.message || 'Failed to get purchases', code: errorData.error?.code },
+        { status: backendResponse.status }
+      );
+    }
+
+    if (format) {
+      return new Response(backendResponse.body, {
+        status: 200,
+        headers: {
+          'Content-Type': backendResponse.headers.get('Content-Type') || 'application/octet-stream',
+          'Content-Disposition': backendResponse.headers.get('Content-Disposition') || '',
+        },
+      });
+    }
+
+    const { purchases, page } = await backendResponse.json();
+
+    return NextResponse.json({
+      success: true,
+      purchases,
+      page
+    });
+  } catch (error) {
+    console.error('Error getting purchases:', error);
+    return NextResponse.json(
+      { success: false, error: 'Internal server error' },
+      { status: 500 }
+    );
+  }
+}
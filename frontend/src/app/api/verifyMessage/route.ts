@@ -12,7 +12,7 @@ export async function POST(request: NextRequest) {
     }
 
     // Call the backend API to verify the message
-    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/verifyMessage`, {
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/verifyMessage`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -23,25 +23,20 @@ export async function POST(request: NextRequest) {
     if (!backendResponse.ok) {
       const errorData = await backendResponse.json();
       return NextResponse.json(
-        { success: false, error: errorData.error || 'Verification failed' },
+        { success: false, error: errorData.error?.message || 'Verification failed', code: errorData.error?.code },
         { status: backendResponse.status }
       );
     }
 
     const verificationResult = await backendResponse.json();
     
-    if (verificationResult.error) {
-      return NextResponse.json(
-        { success: false, error: verificationResult.error },
-        { status: 400 }
-      );
-    }
-
     return NextResponse.json({ 
       success: true,
       verified: true,
       pubkey: verificationResult.pubkey,
-      alias: verificationResult.alias || 'Unknown'
+      alias: verificationResult.alias || 'Unknown',
+      token: verificationResult.token,
+      expiresAt: verificationResult.expiresAt
     });
   } catch (error) {
     console.error('Error verifying message:', error);
@@ -2,44 +2,39 @@ import { NextRequest, NextResponse } from "next/server";
 
 export async function POST(request: NextRequest) {
   try {
-    const { assetName, rawProofFile } = await request.json();
+    const { assetId, groupKey, rawProofFile } = await request.json();
 
-    if (!assetName || !rawProofFile) {
+    if ((!assetId && !groupKey) || !rawProofFile) {
       return NextResponse.json(
-        { success: false, error: 'Asset name and raw proof file are required' },
+        { success: false, error: 'Asset ID or group key and raw proof file are required' },
         { status: 400 }
       );
     }
 
     // Call the backend API to verify the proof
-    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/verifyProof`, {
+    const backendResponse = await fetch(`${process.env.BACKEND_URL || 'http://localhost:8082'}/v1/verifyProof`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
+        'Authorization': request.headers.get('Authorization') || '',
       },
-      body: JSON.stringify({ assetName, rawProofFile }),
+      body: JSON.stringify({ assetId, groupKey, rawProofFile }),
     });
 
     if (!backendResponse.ok) {
       const errorData = await backendResponse.json();
       return NextResponse.json(
-        { success: false, error: errorData.error || 'Proof verification failed' },
+        { success: false, error: errorData.error?.message || 'Proof verification failed', code: errorData.error?.code },
         { status: backendResponse.status }
       );
     }
 
     const verificationResult = await backendResponse.json();
     
-    if (verificationResult.error) {
-      return NextResponse.json(
-        { success: false, error: verificationResult.error },
-        { status: 400 }
-      );
-    }
-
     return NextResponse.json({ 
       success: true,
-      verified: verificationResult.success
+      verified: verificationResult.success,
+      proof: verificationResult.proof
     });
   } catch (error) {
     console.error('Error verifying proof:', error);
@@ -14,16 +14,19 @@ import { truncateUsername } from "../utils/stringUtils";
 
 interface AssetPurchaseFlowProps {
   assetId?: string;
+  listingId?: number;
   onNavigate: (page: string, params?: Record<string, unknown>) => void;
 }
 
 export function AssetPurchaseFlow({
   assetId: _ = "1", 
+  listingId = 1,
   onNavigate,
 }: AssetPurchaseFlowProps) {
   const [step, setStep] = useState(1);
   const [quantity, setQuantity] = useState("100");
   const [invoice, setInvoice] = useState<string>("");
+  const [paymentHash, setPaymentHash] = useState<string>("");
   const [isGeneratingInvoice, setIsGeneratingInvoice] = useState(false);
   const [paymentStatus, setPaymentStatus] = useState<"pending" | "checking" | "paid">("pending");
 
@@ -44,9 +47,8 @@ export function AssetPurchaseFlow({
           "Content-Type": "application/json",
         },
         body: JSON.stringify({
-          assetId: "gaming-credits",
+          listingId,
           assetAmount: quantity,
-          userPubkey: currentUser.pubkey,
         }),
       });
 
@@ -61,7 +63,8 @@ export function AssetPurchaseFlow({
       }
 
       const data = await response.json();
-      setInvoice(data.encoded_invoice || data.payment_request || "lnbc1example...");
+      setInvoice(data.invoice.paymentRequest);
+      setPaymentHash(data.invoice.paymentHash);
       setStep(2);
     } catch (error) {
       console.error("Error generating invoice:", error);
@@ -77,13 +80,25 @@ export function AssetPurchaseFlow({
     navigator.clipboard.writeText(text);
   };
 
-  const checkPaymentStatus = () => {
+  const checkPaymentStatus = async () => {
     setPaymentStatus("checking");
-    // Simulate payment checking
-    setTimeout(() => {
-      setPaymentStatus("paid");
-      setStep(3);
-    }, 2000);
+    try {
+      const response = await fetch(`/api/invoiceStatus?paymentHash=${encodeURIComponent(paymentHash)}`);
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || "Failed to check payment status");
+      }
+
+      if (data.invoice.state === "SETTLED") {
+        setPaymentStatus("paid");
+        setStep(3);
+      } else {
+        setPaymentStatus("pending");
+      }
+    } catch (error) {
+      console.error("Error checking payment status:", error);
+      setPaymentStatus("pending");
+    }
   };
 
   // Check authentication status
@@ -0,0 +1,366 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotReady is returned by lookups made before the graph has been loaded.
+var ErrNotReady = errors.New("channel graph not loaded yet")
+
+// ChangeType is the kind of change the index saw.
+type ChangeType string
+
+const (
+	// EdgeAdded is raised for a channel the index didn't know about.
+	EdgeAdded ChangeType = "edge_added"
+
+	// EdgeRemoved is raised when a known channel closes.
+	EdgeRemoved ChangeType = "edge_removed"
+
+	// Reloaded is raised every time the full graph has been (re)loaded,
+	// changes may have been missed while the subscription was down.
+	Reloaded ChangeType = "reloaded"
+)
+
+// Change is a change to the index. Edge is nil for Reloaded.
+type Change struct {
+	Type ChangeType
+	Edge *lnrpc.ChannelEdge
+}
+
+// retryDelay is how long the index waits before resubscribing after the
+// graph subscription fails.
+const retryDelay = 5 * time.Second
+
+// subscriberBuffer is how many changes a slow subscriber may fall behind by
+// before changes are dropped for it.
+const subscriberBuffer = 256
+
+// Index is an in-memory copy of lnd's channel graph. It is loaded once with
+// DescribeGraph and then kept current from SubscribeChannelGraph, so lookups
+// never go back to lnd.
+//
+// Edges and nodes handed out are never modified afterwards, updates replace
+// them with a fresh copy.
+type Index struct {
+	lightningClient lnrpc.LightningClient
+
+	mu     sync.RWMutex
+	ready  bool
+	nodes  map[string]*lnrpc.LightningNode
+	edges  map[string]*lnrpc.ChannelEdge
+	byNode map[string]map[string]struct{}
+
+	subsMu sync.Mutex
+	nextID int
+	subs   map[int]chan Change
+}
+
+func NewIndex(lightningClient lnrpc.LightningClient) *Index {
+	return &Index{
+		lightningClient: lightningClient,
+		subs:            make(map[int]chan Change),
+	}
+}
+
+// Subscribe returns a channel that receives every change from now on, and a
+// function to stop receiving them. Changes are dropped for subscribers that
+// fall too far behind.
+func (g *Index) Subscribe() (<-chan Change, func()) {
+	g.subsMu.Lock()
+	defer g.subsMu.Unlock()
+
+	id := g.nextID
+	g.nextID++
+	changes := make(chan Change, subscriberBuffer)
+	g.subs[id] = changes
+
+	return changes, func() {
+		g.subsMu.Lock()
+		defer g.subsMu.Unlock()
+		if _, ok := g.subs[id]; ok {
+			delete(g.subs, id)
+			close(changes)
+		}
+	}
+}
+
+func (g *Index) publish(c Change) {
+	g.subsMu.Lock()
+	defer g.subsMu.Unlock()
+
+	for id, changes := range g.subs {
+		select {
+		case changes <- c:
+		default:
+			log.Printf("graph: subscriber %d is falling behind, dropping %s change\n", id, c.Type)
+		}
+	}
+}
+
+// Run keeps the index current until ctx is cancelled, reloading the whole
+// graph whenever the subscription has to be re-established.
+func (g *Index) Run(ctx context.Context) {
+	for {
+		err := g.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("graph: channel graph subscription failed: %s ... retrying in %s\n", err, retryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (g *Index) follow(ctx context.Context) error {
+	// Subscribe before loading so nothing that happens in between is
+	// missed. Updates for what the load already has are no-ops.
+	stream, err := g.lightningClient.SubscribeChannelGraph(ctx, &lnrpc.GraphTopologySubscription{})
+	if err != nil {
+		return err
+	}
+
+	if err := g.load(ctx); err != nil {
+		return err
+	}
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		g.apply(update)
+	}
+}
+
+func (g *Index) load(ctx context.Context) error {
+	channelGraph, err := g.lightningClient.DescribeGraph(ctx, &lnrpc.ChannelGraphRequest{IncludeUnannounced: true})
+	if err != nil {
+		return fmt.Errorf("error getting channel graph: %w", err)
+	}
+
+	nodes := make(map[string]*lnrpc.LightningNode, len(channelGraph.Nodes))
+	for _, node := range channelGraph.Nodes {
+		nodes[node.PubKey] = node
+	}
+	edges := make(map[string]*lnrpc.ChannelEdge, len(channelGraph.Edges))
+	byNode := make(map[string]map[string]struct{})
+	for _, edge := range channelGraph.Edges {
+		edges[edge.ChanPoint] = edge
+		addToNode(byNode, edge.Node1Pub, edge.ChanPoint)
+		addToNode(byNode, edge.Node2Pub, edge.ChanPoint)
+	}
+
+	g.mu.Lock()
+	g.nodes, g.edges, g.byNode = nodes, edges, byNode
+	g.ready = true
+	g.mu.Unlock()
+
+	log.Printf("graph: loaded %d nodes and %d channels\n", len(nodes), len(edges))
+	g.publish(Change{Type: Reloaded})
+
+	return nil
+}
+
+func addToNode(byNode map[string]map[string]struct{}, pubkey, chanPoint string) {
+	points, ok := byNode[pubkey]
+	if !ok {
+		points = make(map[string]struct{})
+		byNode[pubkey] = points
+	}
+	points[chanPoint] = struct{}{}
+}
+
+func removeFromNode(byNode map[string]map[string]struct{}, pubkey, chanPoint string) {
+	delete(byNode[pubkey], chanPoint)
+	if len(byNode[pubkey]) == 0 {
+		delete(byNode, pubkey)
+	}
+}
+
+func (g *Index) apply(update *lnrpc.GraphTopologyUpdate) {
+	var changes []Change
+
+	g.mu.Lock()
+	for _, nu := range update.NodeUpdates {
+		g.nodes[nu.IdentityKey] = &lnrpc.LightningNode{
+			PubKey:     nu.IdentityKey,
+			Alias:      nu.Alias,
+			Color:      nu.Color,
+			Features:   nu.Features,
+			Addresses:  nu.NodeAddresses,
+			LastUpdate: uint32(time.Now().Unix()),
+		}
+	}
+
+	for _, cu := range update.ChannelUpdates {
+		chanPoint, err := FormatChanPoint(cu.ChanPoint)
+		if err != nil {
+			log.Printf("graph: skipping channel update: %s\n", err)
+			continue
+		}
+
+		edge, known := g.edges[chanPoint]
+		if known {
+			edge = proto.Clone(edge).(*lnrpc.ChannelEdge)
+		} else {
+			// lnd orders the two ends of a channel by pubkey.
+			node1, node2 := cu.AdvertisingNode, cu.ConnectingNode
+			if node2 < node1 {
+				node1, node2 = node2, node1
+			}
+			edge = &lnrpc.ChannelEdge{
+				ChannelId: cu.ChanId,
+				ChanPoint: chanPoint,
+				Node1Pub:  node1,
+				Node2Pub:  node2,
+				Capacity:  cu.Capacity,
+			}
+		}
+
+		if cu.AdvertisingNode == edge.Node1Pub {
+			edge.Node1Policy = cu.RoutingPolicy
+		} else {
+			edge.Node2Policy = cu.RoutingPolicy
+		}
+		if cu.RoutingPolicy != nil && cu.RoutingPolicy.LastUpdate > edge.LastUpdate {
+			edge.LastUpdate = cu.RoutingPolicy.LastUpdate
+		}
+
+		g.edges[chanPoint] = edge
+		if !known {
+			addToNode(g.byNode, edge.Node1Pub, chanPoint)
+			addToNode(g.byNode, edge.Node2Pub, chanPoint)
+			changes = append(changes, Change{Type: EdgeAdded, Edge: edge})
+		}
+	}
+
+	for _, cc := range update.ClosedChans {
+		chanPoint, err := FormatChanPoint(cc.ChanPoint)
+		if err != nil {
+			log.Printf("graph: skipping closed channel: %s\n", err)
+			continue
+		}
+
+		edge, ok := g.edges[chanPoint]
+		if !ok {
+			continue
+		}
+		delete(g.edges, chanPoint)
+		removeFromNode(g.byNode, edge.Node1Pub, chanPoint)
+		removeFromNode(g.byNode, edge.Node2Pub, chanPoint)
+		changes = append(changes, Change{Type: EdgeRemoved, Edge: edge})
+	}
+	g.mu.Unlock()
+
+	for _, c := range changes {
+		g.publish(c)
+	}
+}
+
+// Ready reports whether the graph has been loaded.
+func (g *Index) Ready() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.ready
+}
+
+// Node returns the node with the given pubkey, if the graph knows it.
+func (g *Index) Node(pubkey string) (*lnrpc.LightningNode, bool, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if !g.ready {
+		return nil, false, ErrNotReady
+	}
+	node, ok := g.nodes[pubkey]
+
+	return node, ok, nil
+}
+
+// Edge returns the channel with the given channel point, if it is open.
+func (g *Index) Edge(chanPoint string) (*lnrpc.ChannelEdge, bool, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if !g.ready {
+		return nil, false, ErrNotReady
+	}
+	edge, ok := g.edges[chanPoint]
+
+	return edge, ok, nil
+}
+
+// ChannelsOf returns every channel the node is a party to.
+func (g *Index) ChannelsOf(pubkey string) ([]*lnrpc.ChannelEdge, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if !g.ready {
+		return nil, ErrNotReady
+	}
+	edges := make([]*lnrpc.ChannelEdge, 0, len(g.byNode[pubkey]))
+	for chanPoint := range g.byNode[pubkey] {
+		edges = append(edges, g.edges[chanPoint])
+	}
+
+	return edges, nil
+}
+
+// ChannelsBetween returns every channel between the two nodes.
+func (g *Index) ChannelsBetween(pk1, pk2 string) ([]*lnrpc.ChannelEdge, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if !g.ready {
+		return nil, ErrNotReady
+	}
+	edges := []*lnrpc.ChannelEdge{}
+	for chanPoint := range g.byNode[pk1] {
+		edge := g.edges[chanPoint]
+		if edge.Node1Pub == pk2 || edge.Node2Pub == pk2 {
+			edges = append(edges, edge)
+		}
+	}
+
+	return edges, nil
+}
+
+// Edges returns every channel in the graph.
+func (g *Index) Edges() ([]*lnrpc.ChannelEdge, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if !g.ready {
+		return nil, ErrNotReady
+	}
+	edges := make([]*lnrpc.ChannelEdge, 0, len(g.edges))
+	for _, edge := range g.edges {
+		edges = append(edges, edge)
+	}
+
+	return edges, nil
+}
+
+// FormatChanPoint renders a channel point the way DescribeGraph does,
+// txid:index.
+func FormatChanPoint(cp *lnrpc.ChannelPoint) (string, error) {
+	txid, err := lnrpc.GetChanPointFundingTxid(cp)
+	if err != nil {
+		return "", fmt.Errorf("invalid channel point: %w", err)
+	}
+
+	return fmt.Sprintf("%s:%d", txid, cp.OutputIndex), nil
+}
@@ -0,0 +1,287 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"TapHub/graph"
+	"TapHub/store"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// EventType is the kind of change the monitor saw in the channel graph.
+type EventType string
+
+const (
+	ChannelOpened EventType = "channel_opened"
+	ChannelClosed EventType = "channel_closed"
+)
+
+// Event is raised whenever a channel involving a registered node appears in
+// or disappears from the channel graph.
+type Event struct {
+	Type    EventType     `json:"type"`
+	Channel store.Channel `json:"channel"`
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind by
+// before events are dropped for it.
+const subscriberBuffer = 64
+
+// Monitor is TapHub's chain monitor. It follows the changes to the channel
+// graph index, records channels involving registered nodes and fans the
+// resulting events out to subscribers.
+type Monitor struct {
+	graph *graph.Index
+	store *store.Store
+
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]chan Event
+
+	// registered caches the registered node pubkeys. It is nil until
+	// first needed and again after NodesChanged.
+	registeredMu sync.Mutex
+	registered   map[string]bool
+
+	// reconciledHeight is the highest funding height in the graph at the
+	// last reconcile. Only Run touches it.
+	reconciledHeight uint32
+}
+
+func New(g *graph.Index, db *store.Store) *Monitor {
+	return &Monitor{
+		graph:       g,
+		store:       db,
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// Subscribe returns a channel that receives every event raised from now on,
+// and a function to stop receiving them.
+func (m *Monitor) Subscribe() (<-chan Event, func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID
+	m.nextID++
+	events := make(chan Event, subscriberBuffer)
+	m.subscribers[id] = events
+
+	return events, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.subscribers[id]; ok {
+			delete(m.subscribers, id)
+			close(events)
+		}
+	}
+}
+
+func (m *Monitor) publish(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, events := range m.subscribers {
+		select {
+		case events <- e:
+		default:
+			log.Printf("monitor: subscriber %d is falling behind, dropping %s event for %s\n", id, e.Type, e.Channel.ChanPoint)
+		}
+	}
+}
+
+// Run follows the channel graph until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	changes, unsubscribe := m.graph.Subscribe()
+	defer unsubscribe()
+
+	// The graph may have been loaded before we subscribed, in which case
+	// there won't be a Reloaded change to start us off.
+	if m.graph.Ready() {
+		if err := m.reconcile(ctx); err != nil {
+			log.Printf("monitor: error reconciling channels: %s\n", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case c := <-changes:
+			if err := m.handleChange(ctx, c); err != nil {
+				log.Printf("monitor: error handling graph change: %s\n", err)
+			}
+		}
+	}
+}
+
+// NodesChanged tells the monitor nodes were registered or deregistered, so
+// its cached set of registered nodes is loaded again.
+func (m *Monitor) NodesChanged() {
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+
+	m.registered = nil
+}
+
+// registeredNodes returns the set of registered node pubkeys, which callers
+// must not modify.
+func (m *Monitor) registeredNodes(ctx context.Context) (map[string]bool, error) {
+	m.registeredMu.Lock()
+	defer m.registeredMu.Unlock()
+
+	if m.registered != nil {
+		return m.registered, nil
+	}
+
+	nodes, err := m.store.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.registered = make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		m.registered[n.Pubkey] = true
+	}
+
+	return m.registered, nil
+}
+
+// fundingHeight is the height of the block a channel was funded in, taken
+// from its short channel ID.
+func fundingHeight(chanID uint64) uint32 {
+	return lnwire.NewShortChanIDFromInt(chanID).BlockHeight
+}
+
+// reconcile brings the recorded channels in line with the full graph, to
+// catch up on anything that happened while the graph wasn't subscribed. On the
+// very first run there is nothing to compare against, so channels are
+// recorded without raising events. After that, channels funded no later than
+// the last reconcile saw were in the graph already, and only show up now
+// because one of their nodes registered since, so they don't raise events
+// either.
+func (m *Monitor) reconcile(ctx context.Context) error {
+	known, err := m.store.ListChannels(ctx, store.ChannelFilter{})
+	if err != nil {
+		return err
+	}
+	firstRun := len(known) == 0
+
+	// Since a restart, the newest recorded channel is all we know.
+	reconciled := m.reconciledHeight
+	if reconciled == 0 {
+		for _, c := range known {
+			reconciled = max(reconciled, fundingHeight(c.ChanID))
+		}
+	}
+
+	registered, err := m.registeredNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	edges, err := m.graph.Edges()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	highest := reconciled
+	inGraph := make(map[string]bool, len(edges))
+	for _, edge := range edges {
+		inGraph[edge.ChanPoint] = true
+		height := fundingHeight(edge.ChannelId)
+		highest = max(highest, height)
+		if !registered[edge.Node1Pub] && !registered[edge.Node2Pub] {
+			continue
+		}
+
+		c := store.Channel{
+			ChanPoint:   edge.ChanPoint,
+			ChanID:      edge.ChannelId,
+			Node1Pubkey: edge.Node1Pub,
+			Node2Pubkey: edge.Node2Pub,
+			Capacity:    edge.Capacity,
+			OpenedAt:    now,
+		}
+		if err := m.recordOpen(ctx, c, !firstRun && height > reconciled); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range known {
+		if c.Open() && !inGraph[c.ChanPoint] {
+			if err := m.recordClose(ctx, c.ChanPoint, now); err != nil {
+				return err
+			}
+		}
+	}
+	m.reconciledHeight = highest
+
+	return nil
+}
+
+func (m *Monitor) handleChange(ctx context.Context, c graph.Change) error {
+	switch c.Type {
+	case graph.Reloaded:
+		return m.reconcile(ctx)
+
+	case graph.EdgeAdded:
+		registered, err := m.registeredNodes(ctx)
+		if err != nil {
+			return err
+		}
+		if !registered[c.Edge.Node1Pub] && !registered[c.Edge.Node2Pub] {
+			return nil
+		}
+
+		return m.recordOpen(ctx, store.Channel{
+			ChanPoint:   c.Edge.ChanPoint,
+			ChanID:      c.Edge.ChannelId,
+			Node1Pubkey: c.Edge.Node1Pub,
+			Node2Pubkey: c.Edge.Node2Pub,
+			Capacity:    c.Edge.Capacity,
+			OpenedAt:    time.Now(),
+		}, true)
+
+	case graph.EdgeRemoved:
+		return m.recordClose(ctx, c.Edge.ChanPoint, time.Now())
+	}
+
+	return nil
+}
+
+func (m *Monitor) recordOpen(ctx context.Context, c store.Channel, notify bool) error {
+	created, err := m.store.RecordChannel(ctx, c)
+	if err != nil {
+		return err
+	}
+	if created && notify {
+		log.Printf("monitor: channel %s opened between %s and %s\n", c.ChanPoint, c.Node1Pubkey, c.Node2Pubkey)
+		m.publish(Event{Type: ChannelOpened, Channel: c})
+	}
+
+	return nil
+}
+
+// recordClose marks the channel closed if it is one we recorded. Channels
+// that never involved a registered node are ignored.
+func (m *Monitor) recordClose(ctx context.Context, chanPoint string, at time.Time) error {
+	c, err := m.store.CloseChannel(ctx, chanPoint, at)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("monitor: channel %s closed between %s and %s\n", c.ChanPoint, c.Node1Pubkey, c.Node2Pubkey)
+	m.publish(Event{Type: ChannelClosed, Channel: *c})
+
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package publicnet keeps connections to addresses nodes hand TapHub, like
+// webhook receivers and price oracles, on the public internet, away from
+// TapHub's own network and the services on its host.
+package publicnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrNotPublic is returned for loopback, private, link-local and other
+// addresses that aren't routable on the public internet.
+var ErrNotPublic = errors.New("address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, not routable on the
+// public internet but not covered by netip's IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublic reports whether addr is on the public internet.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// Control is a net.Dialer Control function refusing to connect to anything
+// but public addresses. It runs on every connection, after the host was
+// resolved, so a host can't be repointed at a private address after it was
+// checked.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addr) {
+		return fmt.Errorf("%w: %s", ErrNotPublic, addr)
+	}
+
+	return nil
+}
+
+// CheckHost resolves host and checks every address it resolves to is
+// public. Connections are checked again by Control, this is for turning bad
+// hosts away when they are handed to TapHub.
+func CheckHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrNotPublic, host, addr)
+		}
+	}
+
+	return nil
+}
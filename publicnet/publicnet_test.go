@@ -0,0 +1,50 @@
+package publicnet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHost(t *testing.T) {
+	ctx := context.Background()
+
+	for _, host := range []string{"1.1.1.1", "2606:4700:4700::1111"} {
+		if err := CheckHost(ctx, host); err != nil {
+			t.Errorf("CheckHost(%q) = %s, want nil", host, err)
+		}
+	}
+
+	for _, host := range []string{
+		"127.0.0.1",
+		"::1",
+		"10.1.2.3",
+		"192.168.1.1",
+		"169.254.169.254",
+		"100.100.100.200",
+		"0.0.0.0",
+		"::ffff:127.0.0.1",
+		"fe80::1",
+		"fd00::1",
+	} {
+		if err := CheckHost(ctx, host); !errors.Is(err, ErrNotPublic) {
+			t.Errorf("CheckHost(%q) = %v, want %v", host, err, ErrNotPublic)
+		}
+	}
+}
+
+func TestControlRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("connected to a loopback server")
+	}))
+	defer srv.Close()
+
+	dialer := &net.Dialer{Control: Control}
+	_, err := dialer.Dial("tcp", srv.Listener.Addr().String())
+	if !errors.Is(err, ErrNotPublic) {
+		t.Fatalf("got error %v, want %v", err, ErrNotPublic)
+	}
+}
@@ -1,6 +1,8 @@
 package rfq
 
 import (
+	"time"
+
 	"google.golang.org/grpc"
 )
 
@@ -29,4 +31,11 @@ type Oracle interface {
 
 	// UpdatePrices fetches and updates the latest prices.
 	UpdatePrices() error
+
+	// GetLastPriceUpdate returns when the prices were last refreshed.
+	GetLastPriceUpdate() time.Time
+
+	// SubscribePrices streams every price update until the returned
+	// function is called.
+	SubscribePrices() (<-chan PriceUpdate, func())
 }
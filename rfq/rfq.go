@@ -58,6 +58,20 @@ type MarketDataConfig struct {
 	DesiredAssetIds      StringSlice
 	Server               *grpc.Server
 	Listener             net.Listener
+	LastPriceUpdate      time.Time
+
+	priceSubsMu  sync.Mutex
+	nextPriceSub int
+	priceSubs    map[int]chan PriceUpdate
+}
+
+// PriceUpdate is published every time the oracle refreshes its prices.
+type PriceUpdate struct {
+	Ticker     string    `json:"ticker"`
+	BidPrice   float64   `json:"bidPrice"`
+	AskPrice   float64   `json:"askPrice"`
+	IndexPrice float64   `json:"indexPrice"`
+	UpdatedAt  time.Time `json:"updatedAt"`
 }
 
 func NewOracle() (*MarketDataConfig, error) {
@@ -302,6 +316,50 @@ func (mdc *MarketDataConfig) GetLatestIndexPrice() float64 {
 	return mdc.LatestIndexPrice
 }
 
+// SubscribePrices returns a channel that receives every price update from
+// now on, and a function to stop receiving them. Updates are dropped for
+// subscribers that fall behind.
+func (mdc *MarketDataConfig) SubscribePrices() (<-chan PriceUpdate, func()) {
+	mdc.priceSubsMu.Lock()
+	defer mdc.priceSubsMu.Unlock()
+
+	if mdc.priceSubs == nil {
+		mdc.priceSubs = make(map[int]chan PriceUpdate)
+	}
+	id := mdc.nextPriceSub
+	mdc.nextPriceSub++
+	updates := make(chan PriceUpdate, 1)
+	mdc.priceSubs[id] = updates
+
+	return updates, func() {
+		mdc.priceSubsMu.Lock()
+		defer mdc.priceSubsMu.Unlock()
+		if _, ok := mdc.priceSubs[id]; ok {
+			delete(mdc.priceSubs, id)
+			close(updates)
+		}
+	}
+}
+
+func (mdc *MarketDataConfig) publishPrices(update PriceUpdate) {
+	mdc.priceSubsMu.Lock()
+	defer mdc.priceSubsMu.Unlock()
+
+	for _, updates := range mdc.priceSubs {
+		select {
+		case updates <- update:
+		default:
+		}
+	}
+}
+
+// GetLastPriceUpdate returns when the prices were last refreshed.
+func (mdc *MarketDataConfig) GetLastPriceUpdate() time.Time {
+	mdc.WriteReceivePriceMu.Lock()
+	defer mdc.WriteReceivePriceMu.Unlock()
+	return mdc.LastPriceUpdate
+}
+
 // UpdatePrices fetches and updates the latest prices.
 func (mdc *MarketDataConfig) UpdatePrices() error {
 	return GetAPINinjaPrice(mdc)
@@ -351,7 +409,17 @@ func GetAPINinjaPrice(mdc *MarketDataConfig) error {
 	log.Printf("--- new exchange ASK price: %f\n", mdc.LatestAskPrice)
 	log.Printf("--- new exchange BID price: %f\n", mdc.LatestBidPrice)
 	log.Printf("--- new INDEX price: %f\n", mdc.LatestIndexPrice)
+	mdc.LastPriceUpdate = time.Now()
+	update := PriceUpdate{
+		Ticker:     mdc.Ticker,
+		BidPrice:   mdc.LatestBidPrice,
+		AskPrice:   mdc.LatestAskPrice,
+		IndexPrice: mdc.LatestIndexPrice,
+		UpdatedAt:  mdc.LastPriceUpdate,
+	}
 	mdc.WriteReceivePriceMu.Unlock()
 
+	mdc.publishPrices(update)
+
 	return nil
 }
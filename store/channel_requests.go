@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ChannelRequestState is a step in the two-channel flow: the buyer opens a
+// sats channel to the seller, the seller answers with an asset channel and
+// the buyer confirms it.
+type ChannelRequestState string
+
+const (
+	StateRequested          ChannelRequestState = "requested"
+	StateSatsChannelSeen    ChannelRequestState = "sats_channel_seen"
+	StateAssetChannelOpened ChannelRequestState = "asset_channel_opened"
+	StateBuyerConfirmed     ChannelRequestState = "buyer_confirmed"
+	StateCompleted          ChannelRequestState = "completed"
+	StateExpired            ChannelRequestState = "expired"
+
+	// StateAssetChannelUnverified is the seller's asset channel when it
+	// is one whose funding only its parties can see, so it's up to the
+	// buyer to confirm it is funded with the asset.
+	StateAssetChannelUnverified ChannelRequestState = "asset_channel_unverified"
+)
+
+// nextStates are the states each non-final state may move forward to. Any
+// non-final state may also expire.
+var nextStates = map[ChannelRequestState][]ChannelRequestState{
+	StateRequested:              {StateSatsChannelSeen},
+	StateSatsChannelSeen:        {StateAssetChannelOpened, StateAssetChannelUnverified},
+	StateAssetChannelOpened:     {StateBuyerConfirmed},
+	StateAssetChannelUnverified: {StateBuyerConfirmed},
+	StateBuyerConfirmed:         {StateCompleted},
+}
+
+// Final reports whether no further transitions are possible from s.
+func (s ChannelRequestState) Final() bool {
+	return s == StateCompleted || s == StateExpired
+}
+
+// CanTransition reports whether a channel request may move from one state to
+// another.
+func CanTransition(from, to ChannelRequestState) bool {
+	if from.Final() {
+		return false
+	}
+	if to == StateExpired {
+		return true
+	}
+
+	return slices.Contains(nextStates[from], to)
+}
+
+// CanAdvance reports whether the buyer of a channel request, or its seller
+// if buyer is false, may move it into state to. Either party may report the
+// sats channel, only the seller its asset channel and only the buyer may
+// confirm it. Requests expire on their own, so neither party may expire one.
+func CanAdvance(to ChannelRequestState, buyer bool) bool {
+	switch to {
+	case StateSatsChannelSeen:
+		return true
+	case StateAssetChannelOpened, StateAssetChannelUnverified:
+		return !buyer
+	case StateBuyerConfirmed, StateCompleted:
+		return buyer
+	}
+
+	return false
+}
+
+// ChannelRequest tracks a buyer's request for an asset channel from the node
+// behind a listing.
+type ChannelRequest struct {
+	ID             int64               `json:"id"`
+	ListingID      int64               `json:"listingId"`
+	BuyerPubkey    string              `json:"buyerPubkey"`
+	SellerPubkey   string              `json:"sellerPubkey"`
+	AssetID        string              `json:"assetId"`
+	AssetAmount    uint64              `json:"assetAmount"`
+	State          ChannelRequestState `json:"state"`
+	SatsChanPoint  string              `json:"satsChanPoint"`
+	AssetChanPoint string              `json:"assetChanPoint"`
+	CreatedAt      time.Time           `json:"createdAt"`
+	UpdatedAt      time.Time           `json:"updatedAt"`
+	ExpiresAt      time.Time           `json:"expiresAt"`
+
+	// CreatedHeight is the chain height when the request was made, zero
+	// for requests made before it was recorded.
+	CreatedHeight uint32 `json:"createdHeight"`
+}
+
+// ChannelRequestFilter narrows down ListChannelRequests. Empty fields match
+// everything.
+type ChannelRequestFilter struct {
+	// Pubkey matches requests where the node is either the buyer or the
+	// seller.
+	Pubkey string
+	State  ChannelRequestState
+}
+
+const channelRequestColumns = `id, COALESCE(listing_id, 0), buyer_pubkey,
+	seller_pubkey, asset_id, asset_amount, state, sats_chan_point,
+	asset_chan_point, created_at, updated_at, expires_at,
+	COALESCE(h.created_height, 0)`
+
+// channelRequestTables joins every channel request with its chain height.
+const channelRequestTables = `channel_requests
+	LEFT JOIN channel_request_heights h ON h.request_id = channel_requests.id`
+
+// CreateChannelRequest stores a new channel request in the requested state.
+func (s *Store) CreateChannelRequest(ctx context.Context, cr ChannelRequest) (*ChannelRequest, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating channel request: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO channel_requests (listing_id, buyer_pubkey,
+			seller_pubkey, asset_id, asset_amount, state, created_at,
+			updated_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cr.ListingID, cr.BuyerPubkey, cr.SellerPubkey, cr.AssetID,
+		cr.AssetAmount, StateRequested, now, now, cr.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating channel request: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error creating channel request: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_request_heights (request_id, created_height)
+		VALUES (?, ?)`, id, cr.CreatedHeight,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error recording height of channel request %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error creating channel request: %w", err)
+	}
+
+	return s.GetChannelRequest(ctx, id)
+}
+
+// GetChannelRequest returns the channel request with the given id, or
+// ErrNotFound.
+func (s *Store) GetChannelRequest(ctx context.Context, id int64) (*ChannelRequest, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+channelRequestColumns+` FROM `+channelRequestTables+`
+		WHERE id = ?`, id,
+	)
+	cr, err := scanChannelRequest(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting channel request %d: %w", id, err)
+	}
+
+	return cr, nil
+}
+
+// ListChannelRequests returns the channel requests matching the filter,
+// newest first.
+func (s *Store) ListChannelRequests(ctx context.Context, f ChannelRequestFilter) ([]ChannelRequest, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.Pubkey != "" {
+		where = append(where, "(buyer_pubkey = ? OR seller_pubkey = ?)")
+		args = append(args, f.Pubkey, f.Pubkey)
+	}
+	if f.State != "" {
+		where = append(where, "state = ?")
+		args = append(args, f.State)
+	}
+
+	query := `SELECT ` + channelRequestColumns + ` FROM ` + channelRequestTables
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing channel requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []ChannelRequest{}
+	for rows.Next() {
+		cr, err := scanChannelRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing channel requests: %w", err)
+		}
+		requests = append(requests, *cr)
+	}
+
+	return requests, rows.Err()
+}
+
+// ErrStateChanged is returned when a channel request is no longer in the
+// state a transition expected it to be in.
+var ErrStateChanged = errors.New("channel request state changed")
+
+// TransitionChannelRequest moves a channel request from one state to another
+// and records the channel point that justified it, if any. The update only
+// happens if the request is still in the from state, so two parties racing
+// to advance the same request can't both succeed.
+func (s *Store) TransitionChannelRequest(ctx context.Context, id int64, from, to ChannelRequestState, chanPoint string) (*ChannelRequest, error) {
+	if !CanTransition(from, to) {
+		return nil, fmt.Errorf("channel request can't move from %s to %s", from, to)
+	}
+
+	set := "state = ?, updated_at = ?"
+	args := []any{to, time.Now().Unix()}
+	switch to {
+	case StateSatsChannelSeen:
+		set += ", sats_chan_point = ?"
+		args = append(args, chanPoint)
+	case StateAssetChannelOpened, StateAssetChannelUnverified:
+		set += ", asset_chan_point = ?"
+		args = append(args, chanPoint)
+	}
+	args = append(args, id, from)
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE channel_requests SET `+set+` WHERE id = ? AND state = ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating channel request %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error updating channel request %d: %w", id, err)
+	}
+	if n == 0 {
+		return nil, ErrStateChanged
+	}
+
+	return s.GetChannelRequest(ctx, id)
+}
+
+// CountOpenChannelRequests returns how many unfinished channel requests the
+// buyer has made to the seller.
+func (s *Store) CountOpenChannelRequests(ctx context.Context, buyer, seller string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM channel_requests
+		WHERE buyer_pubkey = ? AND seller_pubkey = ?
+			AND state NOT IN (?, ?)`,
+		buyer, seller, StateCompleted, StateExpired,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("error counting open channel requests: %w", err)
+	}
+
+	return n, nil
+}
+
+// ExpireChannelRequests moves every unfinished channel request whose expiry
+// has passed into the expired state.
+func (s *Store) ExpireChannelRequests(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE channel_requests SET state = ?, updated_at = ?
+		WHERE expires_at <= ? AND state NOT IN (?, ?)`,
+		StateExpired, now.Unix(), now.Unix(), StateCompleted, StateExpired,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error expiring channel requests: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+func scanChannelRequest(row scanner) (*ChannelRequest, error) {
+	var (
+		cr                              ChannelRequest
+		createdAt, updatedAt, expiresAt int64
+	)
+	err := row.Scan(
+		&cr.ID, &cr.ListingID, &cr.BuyerPubkey, &cr.SellerPubkey,
+		&cr.AssetID, &cr.AssetAmount, &cr.State, &cr.SatsChanPoint,
+		&cr.AssetChanPoint, &createdAt, &updatedAt, &expiresAt,
+		&cr.CreatedHeight,
+	)
+	if err != nil {
+		return nil, err
+	}
+	cr.CreatedAt = time.Unix(createdAt, 0)
+	cr.UpdatedAt = time.Unix(updatedAt, 0)
+	cr.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return &cr, nil
+}
@@ -0,0 +1,300 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testBuyer  = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testSeller = "03bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	testAsset  = "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(filepath.Join(t.TempDir(), "taphub.db"))
+	if err != nil {
+		t.Fatalf("error opening store: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// createTestRequest stores a channel request from testBuyer for the
+// seller's listing of testAsset, creating the seller and listing first if
+// needed.
+func createTestRequest(t *testing.T, s *Store, expiresAt time.Time) *ChannelRequest {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := s.RegisterNode(ctx, Node{Pubkey: testSeller, Alias: "seller"}); err != nil {
+		t.Fatalf("error registering seller: %s", err)
+	}
+	listings, err := s.ListListings(ctx, ListingFilter{AssetID: testAsset})
+	if err != nil {
+		t.Fatalf("error listing listings: %s", err)
+	}
+	var listingID int64
+	if len(listings) > 0 {
+		listingID = listings[0].ID
+	} else {
+		l, err := s.CreateListing(ctx, Listing{
+			NodePubkey:  testSeller,
+			AssetID:     testAsset,
+			AssetName:   "test",
+			SatsPerUnit: 10,
+			MinAmount:   1,
+			MaxAmount:   1000,
+		})
+		if err != nil {
+			t.Fatalf("error creating listing: %s", err)
+		}
+		listingID = l.ID
+	}
+
+	cr, err := s.CreateChannelRequest(ctx, ChannelRequest{
+		ListingID:     listingID,
+		BuyerPubkey:   testBuyer,
+		SellerPubkey:  testSeller,
+		AssetID:       testAsset,
+		AssetAmount:   100,
+		ExpiresAt:     expiresAt,
+		CreatedHeight: 800000,
+	})
+	if err != nil {
+		t.Fatalf("error creating channel request: %s", err)
+	}
+
+	return cr
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to ChannelRequestState
+		want     bool
+	}{
+		{StateRequested, StateSatsChannelSeen, true},
+		{StateSatsChannelSeen, StateAssetChannelOpened, true},
+		{StateSatsChannelSeen, StateAssetChannelUnverified, true},
+		{StateAssetChannelOpened, StateBuyerConfirmed, true},
+		{StateAssetChannelUnverified, StateBuyerConfirmed, true},
+		{StateBuyerConfirmed, StateCompleted, true},
+
+		// Steps can't be skipped.
+		{StateRequested, StateAssetChannelOpened, false},
+		{StateRequested, StateCompleted, false},
+		{StateSatsChannelSeen, StateBuyerConfirmed, false},
+		{StateAssetChannelOpened, StateCompleted, false},
+
+		// Or taken back, or repeated.
+		{StateSatsChannelSeen, StateRequested, false},
+		{StateBuyerConfirmed, StateAssetChannelOpened, false},
+		{StateAssetChannelOpened, StateAssetChannelUnverified, false},
+		{StateAssetChannelUnverified, StateAssetChannelOpened, false},
+		{StateSatsChannelSeen, StateSatsChannelSeen, false},
+
+		// Anything unfinished may expire.
+		{StateRequested, StateExpired, true},
+		{StateSatsChannelSeen, StateExpired, true},
+		{StateAssetChannelOpened, StateExpired, true},
+		{StateAssetChannelUnverified, StateExpired, true},
+		{StateBuyerConfirmed, StateExpired, true},
+
+		// Final states stay put.
+		{StateCompleted, StateExpired, false},
+		{StateCompleted, StateRequested, false},
+		{StateExpired, StateExpired, false},
+		{StateExpired, StateSatsChannelSeen, false},
+
+		{StateRequested, "bogus", false},
+		{"bogus", StateSatsChannelSeen, false},
+	}
+	for _, test := range tests {
+		if got := CanTransition(test.from, test.to); got != test.want {
+			t.Errorf("CanTransition(%s, %s) = %t, want %t", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestCanAdvance(t *testing.T) {
+	tests := []struct {
+		to            ChannelRequestState
+		buyer, seller bool
+	}{
+		{StateRequested, false, false},
+		{StateSatsChannelSeen, true, true},
+		{StateAssetChannelOpened, false, true},
+		{StateAssetChannelUnverified, false, true},
+		{StateBuyerConfirmed, true, false},
+		{StateCompleted, true, false},
+		{StateExpired, false, false},
+	}
+	for _, test := range tests {
+		if got := CanAdvance(test.to, true); got != test.buyer {
+			t.Errorf("buyer CanAdvance(%s) = %t, want %t", test.to, got, test.buyer)
+		}
+		if got := CanAdvance(test.to, false); got != test.seller {
+			t.Errorf("seller CanAdvance(%s) = %t, want %t", test.to, got, test.seller)
+		}
+	}
+}
+
+func TestTransitionChannelRequest(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		steps []ChannelRequestState
+	}{
+		{
+			name: "verified asset channel",
+			steps: []ChannelRequestState{
+				StateSatsChannelSeen, StateAssetChannelOpened,
+				StateBuyerConfirmed, StateCompleted,
+			},
+		},
+		{
+			name: "unverified asset channel",
+			steps: []ChannelRequestState{
+				StateSatsChannelSeen, StateAssetChannelUnverified,
+				StateBuyerConfirmed, StateCompleted,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := openTestStore(t)
+			cr := createTestRequest(t, s, time.Now().Add(time.Hour))
+			if cr.State != StateRequested {
+				t.Fatalf("new request in state %s, want %s", cr.State, StateRequested)
+			}
+
+			for _, to := range test.steps {
+				got, err := s.TransitionChannelRequest(ctx, cr.ID, cr.State, to, "txid:"+string(to))
+				if err != nil {
+					t.Fatalf("error moving from %s to %s: %s", cr.State, to, err)
+				}
+				if got.State != to {
+					t.Fatalf("request in state %s, want %s", got.State, to)
+				}
+				cr = got
+			}
+
+			// Only the channel reporting steps record their channel.
+			if want := "txid:" + string(StateSatsChannelSeen); cr.SatsChanPoint != want {
+				t.Errorf("sats channel %q, want %q", cr.SatsChanPoint, want)
+			}
+			if want := "txid:" + string(test.steps[1]); cr.AssetChanPoint != want {
+				t.Errorf("asset channel %q, want %q", cr.AssetChanPoint, want)
+			}
+		})
+	}
+}
+
+func TestTransitionChannelRequestRejects(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	cr := createTestRequest(t, s, time.Now().Add(time.Hour))
+
+	// Transitions that aren't allowed fail before touching the request.
+	_, err := s.TransitionChannelRequest(ctx, cr.ID, StateRequested, StateCompleted, "")
+	if err == nil || errors.Is(err, ErrStateChanged) {
+		t.Fatalf("skipping to completed: got error %v, want an invalid transition", err)
+	}
+
+	// A stale from state loses the race.
+	_, err = s.TransitionChannelRequest(ctx, cr.ID, StateSatsChannelSeen, StateAssetChannelOpened, "txid:1")
+	if !errors.Is(err, ErrStateChanged) {
+		t.Fatalf("got error %v, want %v", err, ErrStateChanged)
+	}
+	if _, err := s.TransitionChannelRequest(ctx, cr.ID, StateRequested, StateSatsChannelSeen, "txid:0"); err != nil {
+		t.Fatalf("error moving to %s: %s", StateSatsChannelSeen, err)
+	}
+	_, err = s.TransitionChannelRequest(ctx, cr.ID, StateRequested, StateSatsChannelSeen, "txid:0")
+	if !errors.Is(err, ErrStateChanged) {
+		t.Fatalf("repeated transition: got error %v, want %v", err, ErrStateChanged)
+	}
+
+	got, err := s.GetChannelRequest(ctx, cr.ID)
+	if err != nil {
+		t.Fatalf("error getting request: %s", err)
+	}
+	if got.State != StateSatsChannelSeen || got.AssetChanPoint != "" {
+		t.Fatalf("request in state %s with asset channel %q, want %s without one", got.State, got.AssetChanPoint, StateSatsChannelSeen)
+	}
+
+	_, err = s.TransitionChannelRequest(ctx, 999, StateRequested, StateSatsChannelSeen, "")
+	if !errors.Is(err, ErrStateChanged) {
+		t.Fatalf("unknown request: got error %v, want %v", err, ErrStateChanged)
+	}
+}
+
+func TestExpireChannelRequests(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+	now := time.Now()
+
+	pending := createTestRequest(t, s, now.Add(-time.Minute))
+	waiting := createTestRequest(t, s, now.Add(-time.Minute))
+	done := createTestRequest(t, s, now.Add(-time.Minute))
+	fresh := createTestRequest(t, s, now.Add(time.Hour))
+
+	if _, err := s.TransitionChannelRequest(ctx, waiting.ID, StateRequested, StateSatsChannelSeen, "txid:0"); err != nil {
+		t.Fatalf("error moving to %s: %s", StateSatsChannelSeen, err)
+	}
+	for _, step := range []struct{ from, to ChannelRequestState }{
+		{StateRequested, StateSatsChannelSeen},
+		{StateSatsChannelSeen, StateAssetChannelOpened},
+		{StateAssetChannelOpened, StateBuyerConfirmed},
+		{StateBuyerConfirmed, StateCompleted},
+	} {
+		if _, err := s.TransitionChannelRequest(ctx, done.ID, step.from, step.to, "txid:1"); err != nil {
+			t.Fatalf("error moving to %s: %s", step.to, err)
+		}
+	}
+
+	n, err := s.ExpireChannelRequests(ctx, now)
+	if err != nil {
+		t.Fatalf("error expiring requests: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expired %d requests, want 2", n)
+	}
+
+	for _, test := range []struct {
+		id   int64
+		want ChannelRequestState
+	}{
+		{pending.ID, StateExpired},
+		{waiting.ID, StateExpired},
+		{done.ID, StateCompleted},
+		{fresh.ID, StateRequested},
+	} {
+		cr, err := s.GetChannelRequest(ctx, test.id)
+		if err != nil {
+			t.Fatalf("error getting request %d: %s", test.id, err)
+		}
+		if cr.State != test.want {
+			t.Errorf("request %d in state %s, want %s", test.id, cr.State, test.want)
+		}
+	}
+
+	// Expired requests can't move on and aren't expired twice.
+	_, err = s.TransitionChannelRequest(ctx, waiting.ID, StateExpired, StateAssetChannelOpened, "txid:2")
+	if err == nil {
+		t.Fatal("moved an expired request on")
+	}
+	n, err = s.ExpireChannelRequests(ctx, now)
+	if err != nil {
+		t.Fatalf("error expiring requests: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("expired %d requests again, want 0", n)
+	}
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Channel is a channel involving at least one registered node, as recorded
+// by the chain monitor.
+type Channel struct {
+	ChanPoint   string    `json:"chanPoint"`
+	ChanID      uint64    `json:"chanId,string"`
+	Node1Pubkey string    `json:"node1Pubkey"`
+	Node2Pubkey string    `json:"node2Pubkey"`
+	Capacity    int64     `json:"capacity"`
+	OpenedAt    time.Time `json:"openedAt"`
+	ClosedAt    time.Time `json:"closedAt,omitzero"`
+}
+
+// Open reports whether the channel hasn't been seen closing.
+func (c Channel) Open() bool {
+	return c.ClosedAt.IsZero()
+}
+
+// ChannelFilter narrows down ListChannels. Empty fields match everything.
+type ChannelFilter struct {
+	// Pubkey matches channels where the node is on either end.
+	Pubkey string
+
+	// Peer further narrows down to channels between Pubkey and Peer.
+	Peer string
+
+	OpenOnly bool
+}
+
+const channelColumns = `chan_point, chan_id, node1_pubkey, node2_pubkey,
+	capacity, opened_at, closed_at`
+
+// RecordChannel stores a newly seen channel. It reports false if the channel
+// was already known.
+func (s *Store) RecordChannel(ctx context.Context, c Channel) (bool, error) {
+	// Channel IDs are uint64 and may use the top bit (alias SCIDs do), so
+	// they are stored bit for bit in sqlite's signed integer.
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO channels (chan_point, chan_id, node1_pubkey,
+			node2_pubkey, capacity, opened_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chan_point) DO NOTHING`,
+		c.ChanPoint, int64(c.ChanID), c.Node1Pubkey, c.Node2Pubkey,
+		c.Capacity, c.OpenedAt.Unix(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("error recording channel %s: %w", c.ChanPoint, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error recording channel %s: %w", c.ChanPoint, err)
+	}
+
+	return n == 1, nil
+}
+
+// CloseChannel marks a known open channel as closed and returns it. It
+// returns ErrNotFound if the channel isn't known or was already closed.
+func (s *Store) CloseChannel(ctx context.Context, chanPoint string, at time.Time) (*Channel, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE channels SET closed_at = ?
+		WHERE chan_point = ? AND closed_at = 0`, at.Unix(), chanPoint,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error closing channel %s: %w", chanPoint, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error closing channel %s: %w", chanPoint, err)
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+channelColumns+` FROM channels WHERE chan_point = ?`, chanPoint,
+	)
+	c, err := scanChannel(row)
+	if err != nil {
+		return nil, fmt.Errorf("error closing channel %s: %w", chanPoint, err)
+	}
+
+	return c, nil
+}
+
+// ListChannels returns the recorded channels matching the filter, newest
+// first.
+func (s *Store) ListChannels(ctx context.Context, f ChannelFilter) ([]Channel, error) {
+	var (
+		where []string
+		args  []any
+	)
+	switch {
+	case f.Pubkey != "" && f.Peer != "":
+		where = append(where, "((node1_pubkey = ? AND node2_pubkey = ?) OR (node1_pubkey = ? AND node2_pubkey = ?))")
+		args = append(args, f.Pubkey, f.Peer, f.Peer, f.Pubkey)
+	case f.Pubkey != "":
+		where = append(where, "(node1_pubkey = ? OR node2_pubkey = ?)")
+		args = append(args, f.Pubkey, f.Pubkey)
+	}
+	if f.OpenOnly {
+		where = append(where, "closed_at = 0")
+	}
+
+	query := `SELECT ` + channelColumns + ` FROM channels`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY opened_at DESC, chan_point"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing channels: %w", err)
+	}
+	defer rows.Close()
+
+	channels := []Channel{}
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing channels: %w", err)
+		}
+		channels = append(channels, *c)
+	}
+
+	return channels, rows.Err()
+}
+
+func scanChannel(row scanner) (*Channel, error) {
+	var (
+		c                  Channel
+		chanID             int64
+		openedAt, closedAt int64
+	)
+	err := row.Scan(
+		&c.ChanPoint, &chanID, &c.Node1Pubkey, &c.Node2Pubkey,
+		&c.Capacity, &openedAt, &closedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.ChanID = uint64(chanID)
+	c.OpenedAt = time.Unix(openedAt, 0)
+	if closedAt != 0 {
+		c.ClosedAt = time.Unix(closedAt, 0)
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Holdings is the proof, checked by TapHub, that the node behind a listing
+// controls an unspent output holding the listed asset.
+type Holdings struct {
+	ListingID   int64  `json:"listingId"`
+	Outpoint    string `json:"outpoint"`
+	ScriptKey   string `json:"scriptKey"`
+	Amount      uint64 `json:"amount"`
+	BlockHeight uint32 `json:"blockHeight"`
+
+	// PkScript is the output script of Outpoint, needed to watch it for
+	// spends.
+	PkScript []byte `json:"-"`
+
+	VerifiedAt time.Time `json:"verifiedAt"`
+	SpentAt    time.Time `json:"spentAt,omitzero"`
+}
+
+// Unspent reports whether the output hasn't been seen spent yet.
+func (h *Holdings) Unspent() bool {
+	return h.SpentAt.IsZero()
+}
+
+// RecordHoldings stores a freshly verified holdings proof for a listing,
+// replacing any earlier one.
+func (s *Store) RecordHoldings(ctx context.Context, h Holdings) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO listing_holdings (listing_id, outpoint, pk_script,
+			script_key, amount, block_height, verified_at, spent_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0)
+		ON CONFLICT (listing_id) DO UPDATE SET
+			outpoint = excluded.outpoint,
+			pk_script = excluded.pk_script,
+			script_key = excluded.script_key,
+			amount = excluded.amount,
+			block_height = excluded.block_height,
+			verified_at = excluded.verified_at,
+			spent_at = 0`,
+		h.ListingID, h.Outpoint, h.PkScript, h.ScriptKey, h.Amount,
+		h.BlockHeight, h.VerifiedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording holdings of listing %d: %w", h.ListingID, err)
+	}
+
+	return nil
+}
+
+// MarkHoldingsSpent records that the output behind a listing's holdings was
+// spent. It reports false if the listing has since proven a different
+// output, or the spend was already recorded.
+func (s *Store) MarkHoldingsSpent(ctx context.Context, listingID int64, outpoint string, at time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE listing_holdings SET spent_at = ?
+		WHERE listing_id = ? AND outpoint = ? AND spent_at = 0`,
+		at.Unix(), listingID, outpoint,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error marking holdings of listing %d spent: %w", listingID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error marking holdings of listing %d spent: %w", listingID, err)
+	}
+
+	return n > 0, nil
+}
+
+// ListUnspentHoldings returns every holdings proof whose output hasn't been
+// seen spent.
+func (s *Store) ListUnspentHoldings(ctx context.Context) ([]Holdings, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT listing_id, outpoint, pk_script, script_key, amount,
+			block_height, verified_at
+		FROM listing_holdings WHERE spent_at = 0`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing unspent holdings: %w", err)
+	}
+	defer rows.Close()
+
+	holdings := []Holdings{}
+	for rows.Next() {
+		var (
+			h          Holdings
+			verifiedAt int64
+		)
+		err := rows.Scan(
+			&h.ListingID, &h.Outpoint, &h.PkScript, &h.ScriptKey,
+			&h.Amount, &h.BlockHeight, &verifiedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error listing unspent holdings: %w", err)
+		}
+		h.VerifiedAt = time.Unix(verifiedAt, 0)
+		holdings = append(holdings, h)
+	}
+
+	return holdings, rows.Err()
+}
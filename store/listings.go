@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Listing is an offer by a registered node to sell an asset at a fixed
+// price.
+type Listing struct {
+	ID         int64  `json:"id"`
+	NodePubkey string `json:"nodePubkey"`
+	AssetID    string `json:"assetId"`
+	AssetName  string `json:"assetName"`
+
+	// SatsPerUnit is the price of a single asset unit.
+	SatsPerUnit uint64 `json:"satsPerUnit"`
+
+	// MinAmount and MaxAmount bound the number of units a single
+	// purchase may be for.
+	MinAmount uint64 `json:"minAmount"`
+	MaxAmount uint64 `json:"maxAmount"`
+
+	// MinChannelSats and MaxChannelSats bound the capacity of the sats
+	// channel the buyer has to open to the node. Zero means no bound.
+	MinChannelSats uint64 `json:"minChannelSats"`
+	MaxChannelSats uint64 `json:"maxChannelSats"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// HoldingsVerified is set while the node has a proven, unspent
+	// output holding the asset. Holdings is the last such proof, kept
+	// after it is spent so buyers can see what happened.
+	HoldingsVerified bool      `json:"holdingsVerified"`
+	Holdings         *Holdings `json:"holdings,omitempty"`
+}
+
+// ListingFilter narrows down ListListings. Empty fields match everything.
+type ListingFilter struct {
+	NodePubkey string
+	AssetID    string
+}
+
+const listingColumns = `l.id, l.node_pubkey, l.asset_id, l.asset_name,
+	l.sats_per_unit, l.min_amount, l.max_amount, l.min_channel_sats,
+	l.max_channel_sats, l.created_at, l.updated_at, h.outpoint, h.pk_script,
+	h.script_key, h.amount, h.block_height, h.verified_at, h.spent_at`
+
+// listingTables joins every listing with its holdings proof, if any.
+const listingTables = `listings l
+	LEFT JOIN listing_holdings h ON h.listing_id = l.id`
+
+// CreateListing stores a new listing. A node can only have one listing per
+// asset.
+func (s *Store) CreateListing(ctx context.Context, l Listing) (*Listing, error) {
+	now := time.Now().Unix()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO listings (node_pubkey, asset_id, asset_name,
+			sats_per_unit, min_amount, max_amount, min_channel_sats,
+			max_channel_sats, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.NodePubkey, l.AssetID, l.AssetName, l.SatsPerUnit, l.MinAmount,
+		l.MaxAmount, l.MinChannelSats, l.MaxChannelSats, now, now,
+	)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating listing for asset %s: %w", l.AssetID, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error creating listing for asset %s: %w", l.AssetID, err)
+	}
+
+	return s.GetListing(ctx, id)
+}
+
+// GetListing returns the listing with the given id, or ErrNotFound.
+func (s *Store) GetListing(ctx context.Context, id int64) (*Listing, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+listingColumns+` FROM `+listingTables+` WHERE l.id = ?`, id,
+	)
+	l, err := scanListing(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting listing %d: %w", id, err)
+	}
+
+	return l, nil
+}
+
+// UpdateListing updates the price, amount limits and channel requirements of
+// a listing owned by l.NodePubkey. The asset of a listing can't be changed.
+func (s *Store) UpdateListing(ctx context.Context, l Listing) (*Listing, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE listings SET
+			sats_per_unit = ?, min_amount = ?, max_amount = ?,
+			min_channel_sats = ?, max_channel_sats = ?, updated_at = ?
+		WHERE id = ? AND node_pubkey = ?`,
+		l.SatsPerUnit, l.MinAmount, l.MaxAmount, l.MinChannelSats,
+		l.MaxChannelSats, time.Now().Unix(), l.ID, l.NodePubkey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating listing %d: %w", l.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error updating listing %d: %w", l.ID, err)
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	return s.GetListing(ctx, l.ID)
+}
+
+// DeleteListing removes a listing owned by nodePubkey.
+func (s *Store) DeleteListing(ctx context.Context, id int64, nodePubkey string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM listings WHERE id = ? AND node_pubkey = ?`, id, nodePubkey,
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting listing %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting listing %d: %w", id, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListListings returns the listings matching the filter, cheapest first.
+func (s *Store) ListListings(ctx context.Context, f ListingFilter) ([]Listing, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.NodePubkey != "" {
+		where = append(where, "l.node_pubkey = ?")
+		args = append(args, f.NodePubkey)
+	}
+	if f.AssetID != "" {
+		where = append(where, "l.asset_id = ?")
+		args = append(args, f.AssetID)
+	}
+
+	query := `SELECT ` + listingColumns + ` FROM ` + listingTables
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY l.sats_per_unit, l.id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing listings: %w", err)
+	}
+	defer rows.Close()
+
+	listings := []Listing{}
+	for rows.Next() {
+		l, err := scanListing(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing listings: %w", err)
+		}
+		listings = append(listings, *l)
+	}
+
+	return listings, rows.Err()
+}
+
+func scanListing(row scanner) (*Listing, error) {
+	var (
+		l                    Listing
+		createdAt, updatedAt int64
+
+		// Holdings columns are NULL for listings that never proved
+		// any.
+		outpoint, scriptKey                      sql.NullString
+		pkScript                                 []byte
+		amount, blockHeight, verifiedAt, spentAt sql.NullInt64
+	)
+	err := row.Scan(
+		&l.ID, &l.NodePubkey, &l.AssetID, &l.AssetName, &l.SatsPerUnit,
+		&l.MinAmount, &l.MaxAmount, &l.MinChannelSats, &l.MaxChannelSats,
+		&createdAt, &updatedAt, &outpoint, &pkScript, &scriptKey, &amount,
+		&blockHeight, &verifiedAt, &spentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.CreatedAt = time.Unix(createdAt, 0)
+	l.UpdatedAt = time.Unix(updatedAt, 0)
+
+	if outpoint.Valid {
+		l.Holdings = &Holdings{
+			ListingID:   l.ID,
+			Outpoint:    outpoint.String,
+			PkScript:    pkScript,
+			ScriptKey:   scriptKey.String,
+			Amount:      uint64(amount.Int64),
+			BlockHeight: uint32(blockHeight.Int64),
+			VerifiedAt:  time.Unix(verifiedAt.Int64, 0),
+		}
+		if spentAt.Int64 != 0 {
+			l.Holdings.SpentAt = time.Unix(spentAt.Int64, 0)
+		}
+		l.HoldingsVerified = l.Holdings.Unspent()
+	}
+
+	return &l, nil
+}
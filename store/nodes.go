@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Node is an edge node that has proven ownership of its pubkey and
+// registered with TapHub.
+type Node struct {
+	Pubkey      string `json:"pubkey"`
+	Alias       string `json:"alias"`
+	Description string `json:"description"`
+
+	// PriceOracle is the host:port of the node's RFQ price oracle, if it
+	// shares one.
+	PriceOracle string `json:"priceOracle,omitempty"`
+
+	RegisteredAt time.Time `json:"registeredAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// nodeColumns are the columns of nodeTables scanNode expects.
+const nodeColumns = `n.pubkey, n.alias, n.description,
+	COALESCE(o.addr, ''), n.registered_at, n.updated_at`
+
+// nodeTables joins every node with its price oracle, if any.
+const nodeTables = `nodes n
+	LEFT JOIN node_price_oracles o ON o.node_pubkey = n.pubkey`
+
+// RegisterNode adds the node to the registry, or updates its alias,
+// description and price oracle if it is already registered.
+func (s *Store) RegisterNode(ctx context.Context, n Node) (*Node, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error registering node %s: %w", n.Pubkey, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO nodes (pubkey, alias, description, registered_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (pubkey) DO UPDATE SET
+			alias = excluded.alias,
+			description = excluded.description,
+			updated_at = excluded.updated_at`,
+		n.Pubkey, n.Alias, n.Description, now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error registering node %s: %w", n.Pubkey, err)
+	}
+
+	if n.PriceOracle == "" {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM node_price_oracles WHERE node_pubkey = ?`, n.Pubkey,
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO node_price_oracles (node_pubkey, addr)
+			VALUES (?, ?)
+			ON CONFLICT (node_pubkey) DO UPDATE SET addr = excluded.addr`,
+			n.Pubkey, n.PriceOracle,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error registering price oracle of node %s: %w", n.Pubkey, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error registering node %s: %w", n.Pubkey, err)
+	}
+
+	return s.GetNode(ctx, n.Pubkey)
+}
+
+// GetNode returns the registered node with the given pubkey, or ErrNotFound.
+func (s *Store) GetNode(ctx context.Context, pubkey string) (*Node, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+nodeColumns+` FROM `+nodeTables+`
+		WHERE n.pubkey = ?`, pubkey,
+	)
+	n, err := scanNode(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting node %s: %w", pubkey, err)
+	}
+
+	return n, nil
+}
+
+// IsRegistered reports whether the pubkey belongs to a registered node.
+func (s *Store) IsRegistered(ctx context.Context, pubkey string) (bool, error) {
+	_, err := s.GetNode(ctx, pubkey)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ListNodes returns every registered node, oldest registration first.
+func (s *Store) ListNodes(ctx context.Context) ([]Node, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+nodeColumns+` FROM `+nodeTables+`
+		ORDER BY n.registered_at, n.pubkey`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := []Node{}
+	for rows.Next() {
+		n, err := scanNode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing nodes: %w", err)
+		}
+		nodes = append(nodes, *n)
+	}
+
+	return nodes, rows.Err()
+}
+
+// DeregisterNode removes the node from the registry.
+func (s *Store) DeregisterNode(ctx context.Context, pubkey string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM nodes WHERE pubkey = ?`, pubkey)
+	if err != nil {
+		return fmt.Errorf("error deregistering node %s: %w", pubkey, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deregistering node %s: %w", pubkey, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanNode(row scanner) (*Node, error) {
+	var (
+		n                       Node
+		registeredAt, updatedAt int64
+	)
+	err := row.Scan(
+		&n.Pubkey, &n.Alias, &n.Description, &n.PriceOracle,
+		&registeredAt, &updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	n.RegisteredAt = time.Unix(registeredAt, 0)
+	n.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &n, nil
+}
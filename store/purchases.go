@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PurchaseState follows the invoice a purchase is paid through.
+type PurchaseState string
+
+const (
+	PurchasePending  PurchaseState = "pending"
+	PurchaseAccepted PurchaseState = "accepted"
+	PurchaseSettled  PurchaseState = "settled"
+	PurchaseCanceled PurchaseState = "canceled"
+)
+
+// Final reports whether the purchase's invoice can't change any more.
+func (s PurchaseState) Final() bool {
+	return s == PurchaseSettled || s == PurchaseCanceled
+}
+
+// Purchase is a buyer's purchase of asset units from a listing's node, paid
+// through an asset invoice.
+type Purchase struct {
+	ID           int64  `json:"id"`
+	ListingID    int64  `json:"listingId"`
+	BuyerPubkey  string `json:"buyerPubkey"`
+	SellerPubkey string `json:"sellerPubkey"`
+	AssetID      string `json:"assetId"`
+
+	// AssetAmount is the number of units bought, InvoiceSats what the
+	// invoice for them asked.
+	AssetAmount uint64 `json:"assetAmount"`
+	InvoiceSats uint64 `json:"invoiceSats"`
+
+	// RateCoefficient and RateScale are the quoted asset units per BTC,
+	// RateCoefficient / 10^RateScale.
+	RateCoefficient string `json:"rateCoefficient"`
+	RateScale       uint32 `json:"rateScale"`
+	QuoteID         string `json:"quoteId"`
+	PaymentHash     string `json:"paymentHash"`
+
+	State PurchaseState `json:"state"`
+
+	// PaidSats and SettledAssetAmount are what the invoice was paid with
+	// once it was.
+	PaidSats           uint64 `json:"paidSats"`
+	SettledAssetAmount uint64 `json:"settledAssetAmount"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	SettledAt time.Time `json:"settledAt,omitzero"`
+}
+
+// PurchaseFilter narrows down ListPurchases. Empty fields match everything.
+type PurchaseFilter struct {
+	// BuyerPubkey and SellerPubkey match purchases by either party, Pubkey
+	// those where the node is either of them.
+	BuyerPubkey  string
+	SellerPubkey string
+	Pubkey       string
+
+	AssetID string
+	State   PurchaseState
+
+	// From and To bound the purchases' creation time, To exclusive.
+	From time.Time
+	To   time.Time
+
+	Offset int
+	Limit  int
+}
+
+const purchaseColumns = `id, COALESCE(listing_id, 0), buyer_pubkey,
+	seller_pubkey, asset_id, asset_amount, invoice_sats, rate_coefficient,
+	rate_scale, quote_id, payment_hash, state, paid_sats,
+	settled_asset_amount, created_at, updated_at, settled_at`
+
+// CreatePurchase records a new purchase in the pending state.
+func (s *Store) CreatePurchase(ctx context.Context, p Purchase) (*Purchase, error) {
+	now := time.Now().Unix()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO purchases (listing_id, buyer_pubkey, seller_pubkey,
+			asset_id, asset_amount, invoice_sats, rate_coefficient,
+			rate_scale, quote_id, payment_hash, state, created_at,
+			updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ListingID, p.BuyerPubkey, p.SellerPubkey, p.AssetID,
+		p.AssetAmount, p.InvoiceSats, p.RateCoefficient, p.RateScale,
+		p.QuoteID, p.PaymentHash, PurchasePending, now, now,
+	)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating purchase: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error creating purchase: %w", err)
+	}
+
+	return s.GetPurchase(ctx, id)
+}
+
+// GetPurchase returns the purchase with the given id, or ErrNotFound.
+func (s *Store) GetPurchase(ctx context.Context, id int64) (*Purchase, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+purchaseColumns+` FROM purchases WHERE id = ?`, id,
+	)
+	p, err := scanPurchase(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting purchase %d: %w", id, err)
+	}
+
+	return p, nil
+}
+
+// ListPurchases returns the purchases matching the filter, newest first.
+func (s *Store) ListPurchases(ctx context.Context, f PurchaseFilter) ([]Purchase, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.BuyerPubkey != "" {
+		where = append(where, "buyer_pubkey = ?")
+		args = append(args, f.BuyerPubkey)
+	}
+	if f.SellerPubkey != "" {
+		where = append(where, "seller_pubkey = ?")
+		args = append(args, f.SellerPubkey)
+	}
+	if f.Pubkey != "" {
+		where = append(where, "(buyer_pubkey = ? OR seller_pubkey = ?)")
+		args = append(args, f.Pubkey, f.Pubkey)
+	}
+	if f.AssetID != "" {
+		where = append(where, "asset_id = ?")
+		args = append(args, f.AssetID)
+	}
+	if f.State != "" {
+		where = append(where, "state = ?")
+		args = append(args, f.State)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.Unix())
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.Unix())
+	}
+
+	query := `SELECT ` + purchaseColumns + ` FROM purchases`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing purchases: %w", err)
+	}
+	defer rows.Close()
+
+	purchases := []Purchase{}
+	for rows.Next() {
+		p, err := scanPurchase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing purchases: %w", err)
+		}
+		purchases = append(purchases, *p)
+	}
+
+	return purchases, rows.Err()
+}
+
+// UnfinishedPurchases returns the purchases whose invoices haven't reached
+// a final state, oldest first.
+func (s *Store) UnfinishedPurchases(ctx context.Context) ([]Purchase, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+purchaseColumns+` FROM purchases
+		WHERE state NOT IN (?, ?)
+		ORDER BY created_at, id`,
+		PurchaseSettled, PurchaseCanceled,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing unfinished purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		p, err := scanPurchase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing unfinished purchases: %w", err)
+		}
+		purchases = append(purchases, *p)
+	}
+
+	return purchases, rows.Err()
+}
+
+// UpdatePurchasePayment records the state of a purchase's invoice and what
+// it was paid with. Purchases already in a final state are left alone. It
+// returns ErrNotFound if no unfinished purchase is paid through the invoice.
+func (s *Store) UpdatePurchasePayment(ctx context.Context, p Purchase) (*Purchase, error) {
+	var settledAt int64
+	if !p.SettledAt.IsZero() {
+		settledAt = p.SettledAt.Unix()
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE purchases SET state = ?, paid_sats = ?,
+			settled_asset_amount = ?, settled_at = ?, updated_at = ?
+		WHERE payment_hash = ? AND state NOT IN (?, ?)`,
+		p.State, p.PaidSats, p.SettledAssetAmount, settledAt,
+		time.Now().Unix(), p.PaymentHash, PurchaseSettled, PurchaseCanceled,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating purchase %s: %w", p.PaymentHash, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error updating purchase %s: %w", p.PaymentHash, err)
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	return s.GetPurchaseByPaymentHash(ctx, p.PaymentHash)
+}
+
+// GetPurchaseByPaymentHash returns the purchase paid through the invoice
+// with the given hex payment hash, or ErrNotFound.
+func (s *Store) GetPurchaseByPaymentHash(ctx context.Context, paymentHash string) (*Purchase, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+purchaseColumns+` FROM purchases WHERE payment_hash = ?`,
+		paymentHash,
+	)
+	p, err := scanPurchase(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting purchase %s: %w", paymentHash, err)
+	}
+
+	return p, nil
+}
+
+func scanPurchase(row scanner) (*Purchase, error) {
+	var (
+		p                               Purchase
+		createdAt, updatedAt, settledAt int64
+	)
+	err := row.Scan(
+		&p.ID, &p.ListingID, &p.BuyerPubkey, &p.SellerPubkey, &p.AssetID,
+		&p.AssetAmount, &p.InvoiceSats, &p.RateCoefficient, &p.RateScale,
+		&p.QuoteID, &p.PaymentHash, &p.State, &p.PaidSats,
+		&p.SettledAssetAmount, &createdAt, &updatedAt, &settledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = time.Unix(createdAt, 0)
+	p.UpdatedAt = time.Unix(updatedAt, 0)
+	if settledAt != 0 {
+		p.SettledAt = time.Unix(settledAt, 0)
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HoldingsVerification is the outcome of one attempt by a node to prove it
+// holds the asset of one of its listings. Unlike the listing's holdings,
+// failed attempts are kept too, and outlive the listing.
+type HoldingsVerification struct {
+	ID         int64     `json:"id"`
+	NodePubkey string    `json:"nodePubkey"`
+	ListingID  int64     `json:"listingId"`
+	AssetID    string    `json:"assetId"`
+	Valid      bool      `json:"valid"`
+	Reason     string    `json:"reason,omitempty"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// ReputationInputs are the counts a node's reputation is worked out from,
+// over the time since Since.
+type ReputationInputs struct {
+	Since time.Time `json:"since"`
+
+	// CompletedRequests counts the channel requests to the node as the
+	// seller that were completed. ExpiredRequests counts those that
+	// expired while it was up to the node to open the asset channel,
+	// after the buyer's sats channel was seen and before an asset channel
+	// was reported. Requests left to expire by their buyers don't count,
+	// nor do those whose unverified asset channel the buyer never
+	// confirmed.
+	CompletedRequests int `json:"completedRequests"`
+	ExpiredRequests   int `json:"expiredRequests"`
+
+	// AvgCompletionSeconds is how long completed requests took on
+	// average, from being requested to the buyer confirming the asset
+	// channel.
+	AvgCompletionSeconds int64 `json:"avgCompletionSeconds"`
+
+	ValidProofs   int `json:"validProofs"`
+	InvalidProofs int `json:"invalidProofs"`
+
+	// UptimeSamples is how often the node was checked for, UpSamples how
+	// often it had an enabled channel in the graph when it was.
+	UptimeSamples int `json:"uptimeSamples"`
+	UpSamples     int `json:"upSamples"`
+}
+
+const holdingsVerificationColumns = `id, node_pubkey, listing_id, asset_id,
+	valid, reason, verified_at`
+
+// RecordHoldingsVerification stores the outcome of a holdings proof.
+func (s *Store) RecordHoldingsVerification(ctx context.Context, v HoldingsVerification) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO holdings_verifications (node_pubkey, listing_id,
+			asset_id, valid, reason, verified_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		v.NodePubkey, v.ListingID, v.AssetID, v.Valid, v.Reason,
+		v.VerifiedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording holdings verification for listing %d: %w", v.ListingID, err)
+	}
+
+	return nil
+}
+
+// ListHoldingsVerifications returns the node's most recent holdings proof
+// outcomes, newest first.
+func (s *Store) ListHoldingsVerifications(ctx context.Context, pubkey string, limit int) ([]HoldingsVerification, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+holdingsVerificationColumns+` FROM holdings_verifications
+		WHERE node_pubkey = ? ORDER BY verified_at DESC, id DESC LIMIT ?`,
+		pubkey, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing holdings verifications: %w", err)
+	}
+	defer rows.Close()
+
+	verifications := []HoldingsVerification{}
+	for rows.Next() {
+		var (
+			v          HoldingsVerification
+			verifiedAt int64
+		)
+		err := rows.Scan(
+			&v.ID, &v.NodePubkey, &v.ListingID, &v.AssetID, &v.Valid,
+			&v.Reason, &verifiedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error listing holdings verifications: %w", err)
+		}
+		v.VerifiedAt = time.Unix(verifiedAt, 0)
+		verifications = append(verifications, v)
+	}
+
+	return verifications, rows.Err()
+}
+
+// RecordUptimeSample counts one check of whether the node was reachable.
+// Samples are kept as daily totals.
+func (s *Store) RecordUptimeSample(ctx context.Context, pubkey string, at time.Time, up bool) error {
+	day := at.UTC().Truncate(24 * time.Hour).Unix()
+	upSamples := 0
+	if up {
+		upSamples = 1
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO node_uptime (node_pubkey, day, samples, up_samples)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (node_pubkey, day) DO UPDATE SET
+			samples = samples + 1,
+			up_samples = up_samples + excluded.up_samples`,
+		pubkey, day, upSamples,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording uptime of %s: %w", pubkey, err)
+	}
+
+	return nil
+}
+
+// ReputationInputs gathers what the node's reputation is worked out from,
+// counting everything that happened since since.
+func (s *Store) ReputationInputs(ctx context.Context, pubkey string, since time.Time) (*ReputationInputs, error) {
+	in := ReputationInputs{Since: since}
+
+	var avgCompletion float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(state = ?), 0),
+			COALESCE(SUM(state = ? AND sats_chan_point != ''
+				AND asset_chan_point = ''), 0),
+			COALESCE(AVG(CASE WHEN state = ? THEN updated_at - created_at END), 0)
+		FROM channel_requests
+		WHERE seller_pubkey = ? AND created_at >= ?`,
+		StateCompleted, StateExpired, StateCompleted, pubkey, since.Unix(),
+	).Scan(&in.CompletedRequests, &in.ExpiredRequests, &avgCompletion)
+	if err != nil {
+		return nil, fmt.Errorf("error counting channel requests of %s: %w", pubkey, err)
+	}
+	in.AvgCompletionSeconds = int64(avgCompletion)
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(valid), 0), COALESCE(SUM(NOT valid), 0)
+		FROM holdings_verifications
+		WHERE node_pubkey = ? AND verified_at >= ?`,
+		pubkey, since.Unix(),
+	).Scan(&in.ValidProofs, &in.InvalidProofs)
+	if err != nil {
+		return nil, fmt.Errorf("error counting holdings verifications of %s: %w", pubkey, err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(samples), 0), COALESCE(SUM(up_samples), 0)
+		FROM node_uptime
+		WHERE node_pubkey = ? AND day >= ?`,
+		pubkey, since.UTC().Truncate(24*time.Hour).Unix(),
+	).Scan(&in.UptimeSamples, &in.UpSamples)
+	if err != nil {
+		return nil, fmt.Errorf("error counting uptime of %s: %w", pubkey, err)
+	}
+
+	return &in, nil
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	// ErrNotFound is returned when a lookup matches no rows.
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlreadyExists is returned when an insert would violate a
+	// uniqueness constraint.
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// Store is TapHub's persistent state, kept in an embedded sqlite database.
+type Store struct {
+	db *sql.DB
+}
+
+// schema is applied in order every time the store is opened, so every
+// statement has to be safe to run against an existing database.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS nodes (
+		pubkey        TEXT PRIMARY KEY,
+		alias         TEXT NOT NULL DEFAULT '',
+		description   TEXT NOT NULL DEFAULT '',
+		registered_at INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS node_price_oracles (
+		node_pubkey TEXT PRIMARY KEY REFERENCES nodes (pubkey) ON DELETE CASCADE,
+		addr        TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS listings (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		node_pubkey      TEXT NOT NULL REFERENCES nodes (pubkey) ON DELETE CASCADE,
+		asset_id         TEXT NOT NULL,
+		asset_name       TEXT NOT NULL DEFAULT '',
+		sats_per_unit    INTEGER NOT NULL,
+		min_amount       INTEGER NOT NULL,
+		max_amount       INTEGER NOT NULL,
+		min_channel_sats INTEGER NOT NULL DEFAULT 0,
+		max_channel_sats INTEGER NOT NULL DEFAULT 0,
+		created_at       INTEGER NOT NULL,
+		updated_at       INTEGER NOT NULL,
+		UNIQUE (node_pubkey, asset_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS listings_asset_id_idx ON listings (asset_id)`,
+	`CREATE TABLE IF NOT EXISTS channel_requests (
+		id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+		listing_id         INTEGER REFERENCES listings (id) ON DELETE SET NULL,
+		buyer_pubkey       TEXT NOT NULL,
+		seller_pubkey      TEXT NOT NULL,
+		asset_id           TEXT NOT NULL,
+		asset_amount       INTEGER NOT NULL,
+		state              TEXT NOT NULL,
+		sats_chan_point    TEXT NOT NULL DEFAULT '',
+		asset_chan_point   TEXT NOT NULL DEFAULT '',
+		created_at         INTEGER NOT NULL,
+		updated_at         INTEGER NOT NULL,
+		expires_at         INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS channel_requests_buyer_idx ON channel_requests (buyer_pubkey)`,
+	`CREATE INDEX IF NOT EXISTS channel_requests_seller_idx ON channel_requests (seller_pubkey)`,
+	`CREATE TABLE IF NOT EXISTS channel_request_heights (
+		request_id     INTEGER PRIMARY KEY REFERENCES channel_requests (id) ON DELETE CASCADE,
+		created_height INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS channels (
+		chan_point   TEXT PRIMARY KEY,
+		chan_id      INTEGER NOT NULL,
+		node1_pubkey TEXT NOT NULL,
+		node2_pubkey TEXT NOT NULL,
+		capacity     INTEGER NOT NULL,
+		opened_at    INTEGER NOT NULL,
+		closed_at    INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS channels_node1_idx ON channels (node1_pubkey)`,
+	`CREATE INDEX IF NOT EXISTS channels_node2_idx ON channels (node2_pubkey)`,
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		node_pubkey TEXT NOT NULL REFERENCES nodes (pubkey) ON DELETE CASCADE,
+		url         TEXT NOT NULL,
+		secret      TEXT NOT NULL,
+		events      TEXT NOT NULL DEFAULT '',
+		created_at  INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id       INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event_type       TEXT NOT NULL,
+		payload          TEXT NOT NULL,
+		status           TEXT NOT NULL,
+		attempts         INTEGER NOT NULL DEFAULT 0,
+		last_status_code INTEGER NOT NULL DEFAULT 0,
+		last_error       TEXT NOT NULL DEFAULT '',
+		next_attempt_at  INTEGER NOT NULL,
+		created_at       INTEGER NOT NULL,
+		delivered_at     INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at)`,
+	`CREATE TABLE IF NOT EXISTS listing_holdings (
+		listing_id   INTEGER PRIMARY KEY REFERENCES listings (id) ON DELETE CASCADE,
+		outpoint     TEXT NOT NULL,
+		pk_script    BLOB NOT NULL,
+		script_key   TEXT NOT NULL,
+		amount       INTEGER NOT NULL,
+		block_height INTEGER NOT NULL,
+		verified_at  INTEGER NOT NULL,
+		spent_at     INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS universe_syncs (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		server      TEXT NOT NULL,
+		mode        TEXT NOT NULL,
+		started_at  INTEGER NOT NULL,
+		finished_at INTEGER NOT NULL DEFAULT 0,
+		universes   INTEGER NOT NULL DEFAULT 0,
+		new_leaves  INTEGER NOT NULL DEFAULT 0,
+		error       TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS universe_syncs_server_idx ON universe_syncs (server, id)`,
+	`CREATE TABLE IF NOT EXISTS universe_asset_syncs (
+		universe   TEXT PRIMARY KEY,
+		sync_id    INTEGER NOT NULL REFERENCES universe_syncs (id) ON DELETE CASCADE,
+		new_leaves INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS purchases (
+		id                   INTEGER PRIMARY KEY AUTOINCREMENT,
+		listing_id           INTEGER REFERENCES listings (id) ON DELETE SET NULL,
+		buyer_pubkey         TEXT NOT NULL,
+		seller_pubkey        TEXT NOT NULL,
+		asset_id             TEXT NOT NULL,
+		asset_amount         INTEGER NOT NULL,
+		invoice_sats         INTEGER NOT NULL,
+		rate_coefficient     TEXT NOT NULL,
+		rate_scale           INTEGER NOT NULL,
+		quote_id             TEXT NOT NULL,
+		payment_hash         TEXT NOT NULL UNIQUE,
+		state                TEXT NOT NULL,
+		paid_sats            INTEGER NOT NULL DEFAULT 0,
+		settled_asset_amount INTEGER NOT NULL DEFAULT 0,
+		created_at           INTEGER NOT NULL,
+		updated_at           INTEGER NOT NULL,
+		settled_at           INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS purchases_buyer_idx ON purchases (buyer_pubkey)`,
+	`CREATE INDEX IF NOT EXISTS purchases_seller_idx ON purchases (seller_pubkey)`,
+	`CREATE TABLE IF NOT EXISTS holdings_verifications (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		node_pubkey TEXT NOT NULL,
+		listing_id  INTEGER NOT NULL,
+		asset_id    TEXT NOT NULL,
+		valid       INTEGER NOT NULL,
+		reason      TEXT NOT NULL DEFAULT '',
+		verified_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS holdings_verifications_node_idx ON holdings_verifications (node_pubkey, verified_at)`,
+	`CREATE TABLE IF NOT EXISTS node_uptime (
+		node_pubkey TEXT NOT NULL,
+		day         INTEGER NOT NULL,
+		samples     INTEGER NOT NULL,
+		up_samples  INTEGER NOT NULL,
+		PRIMARY KEY (node_pubkey, day)
+	)`,
+}
+
+// Open opens (creating if needed) the sqlite database at path and brings its
+// schema up to date.
+func Open(path string) (*Store, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %w", path, err)
+	}
+
+	// sqlite only allows a single writer, serialize everything through
+	// one connection rather than fighting over the lock.
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error applying schema: %w", err)
+		}
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks that the database is still reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY
+// constraint.
+func isUniqueViolation(err error) bool {
+	var se *sqlite.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	return se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+		se.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UniverseSync is one sync of our universe with a federation server.
+type UniverseSync struct {
+	ID        int64     `json:"id"`
+	Server    string    `json:"server"`
+	Mode      string    `json:"mode"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// FinishedAt is zero while the sync is running.
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+
+	// Universes is the number of asset universes that changed, NewLeaves
+	// the number of proofs they gained.
+	Universes int    `json:"universes"`
+	NewLeaves int    `json:"newLeaves"`
+	Error     string `json:"error,omitempty"`
+
+	// Synced maps each universe that changed, by its hex asset id or
+	// x-only group key, to the number of proofs it gained.
+	Synced map[string]int `json:"-"`
+}
+
+// AssetSync is the last sync that changed an asset's universe.
+type AssetSync struct {
+	SyncID    int64     `json:"syncId"`
+	Server    string    `json:"server"`
+	SyncedAt  time.Time `json:"syncedAt"`
+	NewLeaves int       `json:"newLeaves"`
+}
+
+const universeSyncColumns = `id, server, mode, started_at, finished_at,
+	universes, new_leaves, error`
+
+// StartUniverseSync records the start of a sync with server.
+func (s *Store) StartUniverseSync(ctx context.Context, server, mode string, at time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO universe_syncs (server, mode, started_at)
+		VALUES (?, ?, ?)`, server, mode, at.Unix(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error recording sync with %s: %w", server, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error recording sync with %s: %w", server, err)
+	}
+
+	return id, nil
+}
+
+// FinishUniverseSync records the outcome of a sync, and the sync as the
+// last one of every universe it changed.
+func (s *Store) FinishUniverseSync(ctx context.Context, u UniverseSync) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error recording outcome of sync %d: %w", u.ID, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE universe_syncs SET
+			finished_at = ?, universes = ?, new_leaves = ?, error = ?
+		WHERE id = ?`,
+		u.FinishedAt.Unix(), u.Universes, u.NewLeaves, u.Error, u.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording outcome of sync %d: %w", u.ID, err)
+	}
+
+	for universe, newLeaves := range u.Synced {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO universe_asset_syncs (universe, sync_id, new_leaves)
+			VALUES (?, ?, ?)
+			ON CONFLICT (universe) DO UPDATE SET
+				sync_id = excluded.sync_id,
+				new_leaves = excluded.new_leaves`,
+			universe, u.ID, newLeaves,
+		)
+		if err != nil {
+			return fmt.Errorf("error recording sync %d of universe %s: %w", u.ID, universe, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error recording outcome of sync %d: %w", u.ID, err)
+	}
+
+	return nil
+}
+
+// LastAssetSyncs returns the last sync that changed each of universes, keyed
+// by universe. Universes no sync has changed are left out.
+func (s *Store) LastAssetSyncs(ctx context.Context, universes []string) (map[string]AssetSync, error) {
+	syncs := make(map[string]AssetSync)
+	if len(universes) == 0 {
+		return syncs, nil
+	}
+
+	args := make([]any, len(universes))
+	for i, universe := range universes {
+		args[i] = universe
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.universe, a.sync_id, u.server, u.finished_at, a.new_leaves
+		FROM universe_asset_syncs a
+		JOIN universe_syncs u ON u.id = a.sync_id
+		WHERE a.universe IN (?`+strings.Repeat(", ?", len(universes)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting last asset syncs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			universe string
+			a        AssetSync
+			syncedAt int64
+		)
+		err := rows.Scan(&universe, &a.SyncID, &a.Server, &syncedAt, &a.NewLeaves)
+		if err != nil {
+			return nil, fmt.Errorf("error getting last asset syncs: %w", err)
+		}
+		a.SyncedAt = time.Unix(syncedAt, 0)
+		syncs[universe] = a
+	}
+
+	return syncs, rows.Err()
+}
+
+// AbandonUniverseSyncs marks every sync that was still running as failed.
+// Syncs run in the background, so any left running when the store is opened
+// were cut short by a restart.
+func (s *Store) AbandonUniverseSyncs(ctx context.Context, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE universe_syncs SET finished_at = ?, error = 'interrupted'
+		WHERE finished_at = 0`, at.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("error abandoning running syncs: %w", err)
+	}
+
+	return nil
+}
+
+// LastUniverseSyncs returns the latest sync with every server we ever synced
+// with, keyed by server.
+func (s *Store) LastUniverseSyncs(ctx context.Context) (map[string]UniverseSync, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+universeSyncColumns+` FROM universe_syncs
+		WHERE id IN (SELECT MAX(id) FROM universe_syncs GROUP BY server)`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting last syncs: %w", err)
+	}
+	defer rows.Close()
+
+	syncs := make(map[string]UniverseSync)
+	for rows.Next() {
+		u, err := scanUniverseSync(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error getting last syncs: %w", err)
+		}
+		syncs[u.Server] = *u
+	}
+
+	return syncs, rows.Err()
+}
+
+// ListUniverseSyncs returns the most recent syncs, newest first, optionally
+// only those with server.
+func (s *Store) ListUniverseSyncs(ctx context.Context, server string, limit int) ([]UniverseSync, error) {
+	query := `SELECT ` + universeSyncColumns + ` FROM universe_syncs`
+	args := []any{}
+	if server != "" {
+		query += " WHERE server = ?"
+		args = append(args, server)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing syncs: %w", err)
+	}
+	defer rows.Close()
+
+	syncs := []UniverseSync{}
+	for rows.Next() {
+		u, err := scanUniverseSync(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing syncs: %w", err)
+		}
+		syncs = append(syncs, *u)
+	}
+
+	return syncs, rows.Err()
+}
+
+func scanUniverseSync(row scanner) (*UniverseSync, error) {
+	var (
+		u                     UniverseSync
+		startedAt, finishedAt int64
+	)
+	err := row.Scan(
+		&u.ID, &u.Server, &u.Mode, &startedAt, &finishedAt, &u.Universes,
+		&u.NewLeaves, &u.Error,
+	)
+	if err != nil {
+		return nil, err
+	}
+	u.StartedAt = time.Unix(startedAt, 0)
+	if finishedAt != 0 {
+		u.FinishedAt = time.Unix(finishedAt, 0)
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,325 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook is an endpoint a registered node wants marketplace events for that
+// concern it delivered to.
+type Webhook struct {
+	ID         int64  `json:"id"`
+	NodePubkey string `json:"nodePubkey"`
+	URL        string `json:"url"`
+
+	// Secret keys the HMAC signature on every delivery. It is only handed
+	// out once, when the webhook is created.
+	Secret string `json:"-"`
+
+	// Events limits the webhook to the given event types. Empty means
+	// every event.
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Wants reports whether the webhook is subscribed to the event type.
+func (wh Webhook) Wants(eventType string) bool {
+	return len(wh.Events) == 0 || slices.Contains(wh.Events, eventType)
+}
+
+// DeliveryStatus is where a webhook delivery is in its retry cycle.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event queued for, or sent to, a webhook. The
+// payload is stored as sent so every retry carries the exact same bytes.
+type WebhookDelivery struct {
+	ID             int64          `json:"id"`
+	WebhookID      int64          `json:"webhookId"`
+	EventType      string         `json:"eventType"`
+	Payload        string         `json:"payload"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	LastStatusCode int            `json:"lastStatusCode"`
+	LastError      string         `json:"lastError"`
+	NextAttemptAt  time.Time      `json:"nextAttemptAt"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	DeliveredAt    time.Time      `json:"deliveredAt,omitzero"`
+}
+
+// WebhookDeliveryFilter narrows down ListWebhookDeliveries. Empty fields
+// match everything.
+type WebhookDeliveryFilter struct {
+	NodePubkey string
+	WebhookID  int64
+	Status     DeliveryStatus
+	Limit      int
+}
+
+const webhookColumns = `id, node_pubkey, url, secret, events, created_at`
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event_type, d.payload,
+	d.status, d.attempts, d.last_status_code, d.last_error,
+	d.next_attempt_at, d.created_at, d.delivered_at`
+
+// CreateWebhook stores a new webhook for a registered node.
+func (s *Store) CreateWebhook(ctx context.Context, wh Webhook) (*Webhook, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhooks (node_pubkey, url, secret, events, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		wh.NodePubkey, wh.URL, wh.Secret, strings.Join(wh.Events, ","),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook: %w", err)
+	}
+
+	return s.GetWebhook(ctx, id)
+}
+
+// GetWebhook returns the webhook with the given id, or ErrNotFound.
+func (s *Store) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id,
+	)
+	wh, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook %d: %w", id, err)
+	}
+
+	return wh, nil
+}
+
+// ListWebhooks returns the webhooks of a node.
+func (s *Store) ListWebhooks(ctx context.Context, nodePubkey string) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+webhookColumns+` FROM webhooks
+		WHERE node_pubkey = ? ORDER BY id`, nodePubkey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error listing webhooks: %w", err)
+		}
+		webhooks = append(webhooks, *wh)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook owned by nodePubkey along with its
+// delivery log.
+func (s *Store) DeleteWebhook(ctx context.Context, id int64, nodePubkey string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM webhooks WHERE id = ? AND node_pubkey = ?`, id, nodePubkey,
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting webhook %d: %w", id, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateWebhookDelivery queues a delivery, due immediately.
+func (s *Store) CreateWebhookDelivery(ctx context.Context, webhookID int64, eventType, payload string) error {
+	now := time.Now().Unix()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload,
+			status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		webhookID, eventType, payload, DeliveryPending, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("error queueing webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next
+// attempt is due, each with the webhook it is for.
+func (s *Store) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, []Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+webhookDeliveryColumns+`, w.id, w.node_pubkey, w.url,
+			w.secret, w.events, w.created_at
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id LIMIT ?`,
+		DeliveryPending, now.Unix(), limit,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		deliveries []WebhookDelivery
+		webhooks   []Webhook
+	)
+	for rows.Next() {
+		var (
+			d                              WebhookDelivery
+			wh                             Webhook
+			nextAttemptAt, createdAt, whAt int64
+			deliveredAt                    int64
+			events                         string
+		)
+		err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.LastStatusCode, &d.LastError, &nextAttemptAt,
+			&createdAt, &deliveredAt, &wh.ID, &wh.NodePubkey, &wh.URL,
+			&wh.Secret, &events, &whAt,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting due webhook deliveries: %w", err)
+		}
+		d.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+		d.CreatedAt = time.Unix(createdAt, 0)
+		wh.Events = splitEvents(events)
+		wh.CreatedAt = time.Unix(whAt, 0)
+
+		deliveries = append(deliveries, d)
+		webhooks = append(webhooks, wh)
+	}
+
+	return deliveries, webhooks, rows.Err()
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt.
+func (s *Store) RecordWebhookAttempt(ctx context.Context, d WebhookDelivery) error {
+	var deliveredAt int64
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = d.DeliveredAt.Unix()
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = ?, attempts = ?,
+			last_status_code = ?, last_error = ?, next_attempt_at = ?,
+			delivered_at = ?
+		WHERE id = ?`,
+		d.Status, d.Attempts, d.LastStatusCode, d.LastError,
+		d.NextAttemptAt.Unix(), deliveredAt, d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording webhook delivery %d: %w", d.ID, err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the delivery log matching the filter, newest
+// first.
+func (s *Store) ListWebhookDeliveries(ctx context.Context, f WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.NodePubkey != "" {
+		where = append(where, "w.node_pubkey = ?")
+		args = append(args, f.NodePubkey)
+	}
+	if f.WebhookID != 0 {
+		where = append(where, "d.webhook_id = ?")
+		args = append(args, f.WebhookID)
+	}
+	if f.Status != "" {
+		where = append(where, "d.status = ?")
+		args = append(args, f.Status)
+	}
+
+	query := `SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY d.id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d                        WebhookDelivery
+			nextAttemptAt, createdAt int64
+			deliveredAt              int64
+		)
+		err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.LastStatusCode, &d.LastError, &nextAttemptAt,
+			&createdAt, &deliveredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+		}
+		d.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+		d.CreatedAt = time.Unix(createdAt, 0)
+		if deliveredAt != 0 {
+			d.DeliveredAt = time.Unix(deliveredAt, 0)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func splitEvents(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+
+	return strings.Split(events, ",")
+}
+
+func scanWebhook(row scanner) (*Webhook, error) {
+	var (
+		wh        Webhook
+		events    string
+		createdAt int64
+	)
+	err := row.Scan(&wh.ID, &wh.NodePubkey, &wh.URL, &wh.Secret, &events, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	wh.Events = splitEvents(events)
+	wh.CreatedAt = time.Unix(createdAt, 0)
+
+	return &wh, nil
+}
@@ -0,0 +1,348 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"TapHub/publicnet"
+	"TapHub/store"
+)
+
+// Event types a webhook can subscribe to.
+const (
+	EventChannelRequestCreated = "channel_request.created"
+	EventChannelRequestUpdated = "channel_request.updated"
+	EventChannelOpened         = "channel.opened"
+	EventChannelClosed         = "channel.closed"
+	EventProofVerified         = "proof.verified"
+)
+
+// EventTypes lists every event type a webhook can subscribe to.
+var EventTypes = []string{
+	EventChannelRequestCreated,
+	EventChannelRequestUpdated,
+	EventChannelOpened,
+	EventChannelClosed,
+	EventProofVerified,
+}
+
+// Headers set on every delivery. The signature is the hex encoded
+// HMAC-SHA256, keyed with the webhook secret, of the timestamp header, a
+// '.', and the raw request body.
+const (
+	HeaderEvent     = "X-TapHub-Event"
+	HeaderDelivery  = "X-TapHub-Delivery"
+	HeaderTimestamp = "X-TapHub-Timestamp"
+	HeaderSignature = "X-TapHub-Signature"
+)
+
+const (
+	// maxAttempts is how many times a delivery is tried before it is
+	// given up on.
+	maxAttempts = 8
+
+	// baseBackoff is the wait after the first failed attempt, doubled for
+	// every attempt after that up to maxBackoff.
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+
+	// pollInterval bounds how long a due retry can wait to be picked up.
+	pollInterval = 5 * time.Second
+
+	deliveryTimeout = 10 * time.Second
+	batchSize       = 50
+
+	// maxConcurrentDeliveries is how many deliveries are sent at once, so
+	// slow receivers don't hold up everyone else's.
+	maxConcurrentDeliveries = 8
+)
+
+// payload is the JSON body of every delivery.
+type payload struct {
+	Type       string    `json:"type"`
+	NodePubkey string    `json:"nodePubkey"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Data       any       `json:"data"`
+}
+
+// Dispatcher queues marketplace events for the webhooks of the nodes they
+// concern and delivers them in the background. Deliveries are kept in the
+// store, so pending retries survive a restart.
+type Dispatcher struct {
+	store  *store.Store
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+
+	// slots limits deliveries in flight to maxConcurrentDeliveries.
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	// inFlight are the IDs of deliveries being sent, which stay due in
+	// the store until their attempt is recorded.
+	mu       sync.Mutex
+	inFlight map[int64]bool
+}
+
+func New(db *store.Store) *Dispatcher {
+	return &Dispatcher{
+		store:    db,
+		client:   newClient(),
+		wake:     make(chan struct{}, 1),
+		now:      time.Now,
+		slots:    make(chan struct{}, maxConcurrentDeliveries),
+		inFlight: make(map[int64]bool),
+	}
+}
+
+// newClient returns the client deliveries are sent with. It doesn't follow
+// redirects and refuses to connect to anything but public addresses. That is
+// checked on every connection rather than once when the webhook is created,
+// so a receiver can't repoint its DNS at TapHub's network later.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: publicnet.Control,
+	}
+
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: deliveryTimeout,
+			MaxIdleConns:        maxConcurrentDeliveries,
+			IdleConnTimeout:     time.Minute,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CheckURL checks rawURL is an absolute http(s) URL whose host only resolves
+// to public addresses, see publicnet.CheckHost. Deliveries check the address
+// again when connecting, this is for telling the node its webhook is unusable
+// up front.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) url")
+	}
+
+	return publicnet.CheckHost(ctx, u.Hostname())
+}
+
+// Sign returns the signature header value for a delivery body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify queues an event for every webhook of nodePubkey subscribed to
+// eventType. Nodes without webhooks are silently skipped.
+func (d *Dispatcher) Notify(ctx context.Context, nodePubkey, eventType string, data any) error {
+	webhooks, err := d.store.ListWebhooks(ctx, nodePubkey)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	queued := false
+	for _, wh := range webhooks {
+		if !wh.Wants(eventType) {
+			continue
+		}
+		if body == nil {
+			body, err = json.Marshal(payload{
+				Type:       eventType,
+				NodePubkey: nodePubkey,
+				CreatedAt:  time.Now(),
+				Data:       data,
+			})
+			if err != nil {
+				return fmt.Errorf("error encoding %s webhook payload: %w", eventType, err)
+			}
+		}
+		if err := d.store.CreateWebhookDelivery(ctx, wh.ID, eventType, string(body)); err != nil {
+			return err
+		}
+		queued = true
+	}
+
+	if queued {
+		d.signal()
+	}
+
+	return nil
+}
+
+// signal wakes Run up to look for due deliveries.
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due webhooks until ctx is cancelled, then waits for the
+// deliveries in flight.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.deliverDue(ctx); err != nil {
+			fmt.Printf("error delivering webhooks: %s\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue starts sending due deliveries, up to maxConcurrentDeliveries at
+// once. Every delivery finishing wakes Run up again, so a backlog keeps
+// draining as slots free up.
+func (d *Dispatcher) deliverDue(ctx context.Context) error {
+	deliveries, webhooks, err := d.store.DueWebhookDeliveries(ctx, d.now(), batchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		delivery, wh := deliveries[i], webhooks[i]
+		if !d.claim(delivery.ID) {
+			continue
+		}
+
+		select {
+		case d.slots <- struct{}{}:
+		default:
+			d.unclaim(delivery.ID)
+			return nil
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+
+			if err := d.attempt(ctx, delivery, wh); err != nil {
+				fmt.Printf("error recording webhook delivery %d: %s\n", delivery.ID, err.Error())
+			}
+
+			<-d.slots
+			d.unclaim(delivery.ID)
+			d.signal()
+		}()
+	}
+
+	return nil
+}
+
+// claim marks the delivery as being sent, reporting false if it already is.
+func (d *Dispatcher) claim(id int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.inFlight[id] {
+		return false
+	}
+	d.inFlight[id] = true
+	return true
+}
+
+func (d *Dispatcher) unclaim(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inFlight, id)
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry
+// with exponential backoff if it failed.
+func (d *Dispatcher) attempt(ctx context.Context, delivery store.WebhookDelivery, wh store.Webhook) error {
+	statusCode, err := d.send(ctx, delivery, wh)
+
+	now := d.now()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = store.DeliveryDelivered
+		delivery.DeliveredAt = now
+
+	case delivery.Attempts >= maxAttempts:
+		fmt.Printf("giving up on webhook delivery %d to %s after %d attempts: %s\n", delivery.ID, wh.URL, delivery.Attempts, err.Error())
+		delivery.Status = store.DeliveryFailed
+		delivery.LastError = err.Error()
+
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts))
+	}
+
+	return d.store.RecordWebhookAttempt(ctx, delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery store.WebhookDelivery, wh store.Webhook) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(wh.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return wait
+}
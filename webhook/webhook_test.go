@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"TapHub/store"
+)
+
+const testPubkey = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+// receiver is a webhook endpoint failing the first failures deliveries it
+// gets and checking the signature on every one.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	failures int
+
+	mu       sync.Mutex
+	received int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Errorf("error reading delivery: %s", err)
+	}
+
+	timestamp := r.Header.Get(HeaderTimestamp)
+	if got, want := r.Header.Get(HeaderSignature), Sign(rc.secret, timestamp, body); got != want {
+		rc.t.Errorf("signature %q, want %q", got, want)
+	}
+	if got := r.Header.Get(HeaderEvent); got != EventChannelOpened {
+		rc.t.Errorf("event header %q, want %q", got, EventChannelOpened)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.received++
+	if rc.received <= rc.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.received
+}
+
+func openStore(t *testing.T) *store.Store {
+	t.Helper()
+
+	db, err := store.Open(filepath.Join(t.TempDir(), "taphub.db"))
+	if err != nil {
+		t.Fatalf("error opening store: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	ctx := context.Background()
+	db := openStore(t)
+
+	if _, err := db.RegisterNode(ctx, store.Node{Pubkey: testPubkey}); err != nil {
+		t.Fatalf("error registering node: %s", err)
+	}
+
+	rc := &receiver{t: t, secret: "s3cret", failures: 1}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	wh, err := db.CreateWebhook(ctx, store.Webhook{
+		NodePubkey: testPubkey,
+		URL:        srv.URL,
+		Secret:     rc.secret,
+	})
+	if err != nil {
+		t.Fatalf("error creating webhook: %s", err)
+	}
+
+	// The test server listens on loopback, which the dispatcher's own
+	// client refuses to connect to.
+	d := New(db)
+	d.client = srv.Client()
+	now := time.Now().Truncate(time.Second)
+	d.now = func() time.Time { return now }
+
+	deliver := func() store.WebhookDelivery {
+		t.Helper()
+
+		if err := d.deliverDue(ctx); err != nil {
+			t.Fatalf("error delivering: %s", err)
+		}
+		d.wg.Wait()
+
+		deliveries, err := db.ListWebhookDeliveries(ctx, store.WebhookDeliveryFilter{
+			NodePubkey: testPubkey,
+			WebhookID:  wh.ID,
+			Limit:      10,
+		})
+		if err != nil {
+			t.Fatalf("error listing deliveries: %s", err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("%d deliveries, want 1", len(deliveries))
+		}
+		return deliveries[0]
+	}
+
+	err = d.Notify(ctx, testPubkey, EventChannelOpened, map[string]string{"chanPoint": "txid:0"})
+	if err != nil {
+		t.Fatalf("error notifying: %s", err)
+	}
+
+	got := deliver()
+	if got.Status != store.DeliveryPending || got.Attempts != 1 || got.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("after failed attempt: status %s, attempts %d, last status code %d", got.Status, got.Attempts, got.LastStatusCode)
+	}
+	if want := now.Add(baseBackoff); !got.NextAttemptAt.Equal(want) {
+		t.Fatalf("next attempt at %s, want %s", got.NextAttemptAt, want)
+	}
+
+	// Not due yet, nothing is sent.
+	deliver()
+	if n := rc.count(); n != 1 {
+		t.Fatalf("receiver got %d deliveries before the retry was due, want 1", n)
+	}
+
+	now = now.Add(baseBackoff)
+	got = deliver()
+	if got.Status != store.DeliveryDelivered || got.Attempts != 2 || got.LastStatusCode != http.StatusOK {
+		t.Fatalf("after retry: status %s, attempts %d, last status code %d", got.Status, got.Attempts, got.LastStatusCode)
+	}
+	if n := rc.count(); n != 2 {
+		t.Fatalf("receiver got %d deliveries, want 2", n)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, baseBackoff},
+		{2, 2 * baseBackoff},
+		{3, 4 * baseBackoff},
+		{8, 128 * baseBackoff},
+		{9, 256 * baseBackoff},
+		{10, maxBackoff},
+		{50, maxBackoff},
+	}
+	for _, test := range tests {
+		if got := backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestClientDoesntFollowRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/", http.StatusFound))
+	defer srv.Close()
+
+	client := srv.Client()
+	client.CheckRedirect = newClient().CheckRedirect
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("error sending request: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+
+	for _, rawURL := range []string{
+		"https://1.1.1.1/hook",
+		"http://[2606:4700:4700::1111]:8080/hook",
+	} {
+		if err := CheckURL(ctx, rawURL); err != nil {
+			t.Errorf("CheckURL(%q) = %s, want nil", rawURL, err)
+		}
+	}
+
+	for _, rawURL := range []string{
+		"ftp://1.1.1.1/",
+		"1.1.1.1:443",
+		"http:///hook",
+		"/relative",
+		"",
+	} {
+		if err := CheckURL(ctx, rawURL); err == nil {
+			t.Errorf("CheckURL(%q) = nil, want an error", rawURL)
+		}
+	}
+}